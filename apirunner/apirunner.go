@@ -18,9 +18,16 @@
 package apirunner
 
 import (
-	"bufio"
 	"crypto/hmac"
 	"crypto/sha1"
+	"csbench/config"
+	"csbench/failure"
+	"csbench/histogram"
+	"csbench/loadprofile"
+	"csbench/lookup"
+	"csbench/metrics"
+	"csbench/samples"
+	"csbench/scenario"
 	"encoding/base64"
 	"encoding/csv"
 	"encoding/json"
@@ -30,29 +37,199 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/montanaflynn/stats"
 	log "github.com/sirupsen/logrus"
 )
 
-var processedAPImap = make(map[string]bool)
-var APIscount = 0
-var SuccessAPIs = 0
-var FailedAPIs = 0
-var TotalTime = 0.0
+// Number of kinds of errors listed in the TopErrors column of the reports
+const topErrors = 3
 
-func generateParams(apiKey string, secretKey string, signatureVersion int, expires int, command string, page int, pagesize int, keyword string) url.Values {
-	log.Info("Starting to generate parameters")
-	params := url.Values{}
+// Settings of a benchmark
+type Options struct {
+	// URL of the API of the management server, like http://host:8080/client/api
+	APIURL string
+	// Client all the calls are sent with, http.DefaultClient if nil
+	HTTPClient *http.Client
+	// Cases run by each profile
+	Scenario *scenario.Scenario
+	// Resolves the placeholders in the parameters of the cases, can be nil if
+	// none of the cases use them
+	Resolver *lookup.Resolver
+	// Defaults of the cases without iterations, concurrency or warm-up calls of their own
+	Iterations  int
+	Concurrency int
+	Warmup      int
+	// Calls the APIs until duration has elapsed instead of for iterations calls
+	Duration time.Duration
+	// Calls the APIs at a constant rate of calls/sec instead of as fast as possible
+	Rate float64
+	// Calls the APIs with a number of clients following the stages
+	Stages []loadprofile.Stage
+	// Page and page sizes of the cases without pages or pagesizes of their own,
+	// no page parameters are sent if Page is 0
+	Page      int
+	PageSizes []int
+	// Fetches all the pages of the collection of every case
+	Traverse bool
+	// Written to the DBprofile column of the reports
+	DBProfile int
+	// How often the jobs of async commands are polled, and for how long
+	JobPollInterval time.Duration
+	JobTimeout      time.Duration
+	// Directory the CSV reports of the run are saved to, like results/<host>/<run-id>.
+	// Nothing is saved if empty
+	ReportDir string
+	// Identifies the run in the Run column of the reports, like the start time of the run
+	Run string
+}
+
+// Calls made during a second of the run
+type TimelinePoint struct {
+	Time   time.Time
+	Calls  int
+	Failed int
+}
+
+// Totals of the calls made by a runner
+type Stats struct {
+	Calls     int
+	Succeeded int
+	Failed    int
+	// Sum of the time taken by the calls in seconds
+	TotalTime float64
+	// Runs that did not meet the expectations of their case
+	FailedExpectations int
+}
+
+/*
+Runs the scenario of the options for one or more profiles, and keeps the
+statistics of all the runs. The report of an API is overwritten by its first
+run, and appended to by the next ones of the same runner.
+
+A runner runs one profile at a time, several runners with different report
+directories can be run in parallel.
+*/
+type Runner struct {
+	options Options
+	// APIs whose report and page size curve have been saved by this runner
+	processedAPIs   map[string]bool
+	processedSweeps map[string]bool
+
+	// Protects the fields below as APIs are executed by concurrent clients
+	lock      sync.Mutex
+	stats     Stats
+	summaries []*Summary
+	errors    *failure.Counter
+	// Calls made every second since the runner was created
+	start    time.Time
+	timeline []TimelinePoint
+}
+
+func New(options Options) *Runner {
+	if options.HTTPClient == nil {
+		options.HTTPClient = http.DefaultClient
+	}
+	if options.JobPollInterval <= 0 {
+		options.JobPollInterval = time.Second
+	}
+	if options.JobTimeout <= 0 {
+		options.JobTimeout = time.Hour
+	}
+	return &Runner{
+		options:         options,
+		processedAPIs:   make(map[string]bool),
+		processedSweeps: make(map[string]bool),
+		errors:          failure.NewCounter(),
+		start:           time.Now(),
+	}
+}
+
+// Returns the totals of the calls made so far
+func (r *Runner) Stats() Stats {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.stats
+}
+
+// Returns the errors of the failed calls made so far, by kind
+func (r *Runner) Errors() *failure.Counter {
+	return r.errors
+}
+
+// Returns the statistics of every run made so far, in the order they were made
+func (r *Runner) Summaries() []*Summary {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]*Summary(nil), r.summaries...)
+}
+
+// Returns the number of calls made every second since the runner was created, up to the last call
+func (r *Runner) Timeline() []TimelinePoint {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]TimelinePoint(nil), r.timeline...)
+}
+
+// Counts the call of the command by the profile, failed if apiErr is set
+func (r *Runner) updateStats(profileName string, command string, apiErr *failure.Error, elapsed float64) {
+	outcome := "success"
+	if apiErr != nil {
+		outcome = string(apiErr.Category)
+	}
+	metrics.ObserveRequest(command, profileName, outcome, elapsed)
+	r.errors.Add(apiErr)
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.stats.Calls++
+	r.stats.TotalTime += elapsed
+	if apiErr == nil {
+		r.stats.Succeeded++
+	} else {
+		r.stats.Failed++
+	}
+
+	second := int(time.Since(r.start).Seconds())
+	for len(r.timeline) <= second {
+		r.timeline = append(r.timeline, TimelinePoint{Time: r.start.Add(time.Duration(len(r.timeline)) * time.Second)})
+	}
+	r.timeline[second].Calls++
+	if apiErr != nil {
+		r.timeline[second].Failed++
+	}
+}
+
+// Signs the parameters of the call with the keys
+func signParams(apiKey string, secretKey string, signatureVersion int, expires int, params url.Values) url.Values {
+	log.Debug("Starting to generate parameters")
 	params.Set("apiKey", apiKey)
-	params.Set("response", "json")
 	params.Set("signatureVersion", strconv.Itoa(signatureVersion))
-	params.Set("listall", "true")
 	params.Set("expires", time.Now().UTC().Add(time.Duration(expires)*time.Second).Format("2006-01-02T15:04:05Z"))
 
+	// Generate and add the signature. CloudStack expects spaces to be encoded
+	// as %20 in the signed string, while Encode turns them into +
+	signature := generateSignature(strings.ReplaceAll(params.Encode(), "+", "%20"), secretKey)
+	params.Set("signature", signature)
+
+	return params
+}
+
+/*
+Returns the parameters of the call without the credentials. listall=true, and
+templatefilter=all for listTemplates, are set by default and can be overridden
+by extraParams.
+*/
+func commandParams(command string, page int, pagesize int, extraParams url.Values) url.Values {
+	params := url.Values{}
+	params.Set("response", "json")
+	params.Set("listall", "true")
 	params.Set("command", command)
 	if command == "listTemplates" {
 		params.Set("templatefilter", "all")
@@ -63,118 +240,517 @@ func generateParams(apiKey string, secretKey string, signatureVersion int, expir
 		params.Set("pagesize", strconv.Itoa(pagesize))
 	}
 
-	if keyword != "" {
-		params.Set("keyword", keyword)
+	for key, values := range extraParams {
+		params[key] = values
 	}
-
-	// Generate and add the signature
-	signature := generateSignature(params.Encode(), secretKey)
-	params.Set("signature", signature)
-
 	return params
 }
 
-func RunAPIs(profileName string, apiURL string, apiKey string, secretKey string, expires int, signatureVersion int, iterations int, page int, pagesize int, dbProfile int) {
+// Returns the parameters as key=value pairs separated by spaces, leaving out the skipped keys
+func formatParams(params url.Values, skip ...string) string {
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		skipped := false
+		for _, skipKey := range skip {
+			skipped = skipped || key == skipKey
+		}
+		if !skipped {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		parts = append(parts, key+"="+strings.Join(params[key], ","))
+	}
+	return strings.Join(parts, " ")
+}
+
+/*
+Runs the cases of the scenario for the profile and returns the statistics of
+the runs. Each case is run for its iterations, or the ones of the options, with
+every page and pagesize of its page matrix. The cases without pagesizes of
+their own are run with each of the page sizes of the options, and the cases run
+with several page sizes have their scaling curve reported. Cases set to
+traverse, or all of them if Traverse is set, fetch all the pages of the
+collection instead.
 
-	log.Infof("Starting to run APIs from listCommands.txt file. Each command in the file will be run for multiple iterations and with page parameters mentioned in the configuration file.")
+Profiles with a username log in and send the session key with their calls,
+the others sign their calls with their API key. Returns an error if the login
+fails.
+*/
+func (r *Runner) Run(profile *config.Profile) ([]*Summary, error) {
+	apiURL := r.options.APIURL
+	httpClient := r.options.HTTPClient
+	resolver := r.options.Resolver
+	page := r.options.Page
+	pagesizes := r.options.PageSizes
+	var cases []*scenario.Case
+	if r.options.Scenario != nil {
+		cases = r.options.Scenario.CasesFor(profile.Name)
+	}
 
-	commandsFile := "listCommands.txt"
+	profileName := profile.Name
+	log.Infof("Starting to run %d cases for the profile %s", len(cases), profileName)
 
-	// Read commands from file
-	commands, commandsKeywordMap, err := readCommandsFromFile(commandsFile)
+	client, authenticate, logout, err := authenticateProfile(httpClient, apiURL, profile)
 	if err != nil {
-		log.Infof("Error reading commands from file: %s\n", err.Error())
-		return
+		return nil, err
 	}
-	reportAppend := false
-	for _, command := range commands {
-		keyword := commandsKeywordMap[command]
-		if processedAPImap[command] {
-			reportAppend = true
+	defer logout()
+	authParams := func(command string, page int, pagesize int, extraParams url.Values) url.Values {
+		return authenticate(commandParams(command, page, pagesize, extraParams))
+	}
+
+	first := len(r.Summaries())
+	for _, testCase := range cases {
+		testCase := testCase
+		caseIterations := r.options.Iterations
+		if testCase.Iterations > 0 {
+			caseIterations = testCase.Iterations
 		}
-		if page != 0 {
-			if iterations != 1 {
-				log.Infof("Calling API [%s] with page %d and pagesize %d -> ", command, page, pagesize)
-			} else {
-				log.Infof("Calling API [%s] -> ", command)
+		caseConcurrency := r.options.Concurrency
+		if testCase.Concurrency > 0 {
+			caseConcurrency = testCase.Concurrency
+		}
+		caseWarmup := r.options.Warmup
+		if testCase.Warmup > 0 {
+			caseWarmup = testCase.Warmup
+		}
+
+		// Cases with each placeholders are run once for every value
+		variants := []map[string]string{testCase.Params}
+		hasRandom := false
+		if lookup.HasPlaceholders(testCase.Params, "") {
+			if resolver == nil {
+				log.Errorf("Skipping case %s, its parameters have placeholders but no resolver is available", testCase.Name)
+				continue
+			}
+			var err error
+			variants, err = resolver.Expand(testCase.Params)
+			if err != nil {
+				log.Errorf("Skipping case %s, failed to resolve its parameters: %s", testCase.Name, err)
+				continue
 			}
+			hasRandom = lookup.HasPlaceholders(testCase.Params, lookup.Random)
+		}
 
-			params := generateParams(apiKey, secretKey, signatureVersion, expires, command, page, pagesize, "")
-			executeAPIandCalculate(profileName, apiURL, command, params, iterations, page, pagesize, "", dbProfile, reportAppend)
-			reportAppend = true
+		// The report of the API is overwritten by its first run, and appended to by
+		// the next ones, including the same API listed again with other parameters
+		reportAppend := r.processedAPIs[testCase.Command]
+		for _, variant := range variants {
+			caseParams := url.Values{}
+			for key, value := range variant {
+				caseParams.Set(key, value)
+			}
+			var curve []*sweepPoint
+			if testCase.Traverse || r.options.Traverse {
+				for _, size := range traversePageSizes(testCase, pagesizes) {
+					size := size
+					log.Infof("Traversing case %s [%s] %s with pagesize %d -> ", testCase.Name, testCase.Command, formatParams(caseParams), size)
+					// Every traversal picks its own random values, and fetches all
+					// its pages with them so that they are of the same collection
+					newTraversal := func() func(casePage int) url.Values {
+						params := caseParams
+						if hasRandom {
+							params = resolver.ResolveRandom(caseParams)
+						}
+						return func(casePage int) url.Values {
+							return authParams(testCase.Command, casePage, size, params)
+						}
+					}
+					summary := r.executeTraversal(profileName, client, testCase, newTraversal, caseIterations, caseConcurrency, caseWarmup, size, caseParams, reportAppend)
+					curve = append(curve, &sweepPoint{Page: AllPages, PageSize: size, Summary: summary})
+					reportAppend = true
+				}
+				r.reportSweep(testCase, curve, caseParams, profileName)
+				continue
+			}
+			for _, pages := range pageMatrix(testCase, page, pagesizes) {
+				casePage, casePageSize := pages[0], pages[1]
+				if casePage != 0 {
+					log.Infof("Calling case %s [%s] %s with page %d and pagesize %d -> ", testCase.Name, testCase.Command, formatParams(caseParams), casePage, casePageSize)
+				} else if len(caseParams) != 0 {
+					log.Infof("Calling case %s [%s] with parameters %s -> ", testCase.Name, testCase.Command, formatParams(caseParams))
+				} else {
+					log.Infof("Calling case %s [%s] -> ", testCase.Name, testCase.Command)
+				}
+
+				newParams := func() url.Values {
+					params := caseParams
+					if hasRandom {
+						params = resolver.ResolveRandom(caseParams)
+					}
+					return authParams(testCase.Command, casePage, casePageSize, params)
+				}
+				jobParams := func(jobId string) url.Values {
+					return authParams("queryAsyncJobResult", 0, 0, url.Values{"jobid": {jobId}})
+				}
+				summary := r.executeAPIandCalculate(profileName, client, testCase, newParams, jobParams, caseIterations, caseConcurrency, caseWarmup, casePage, casePageSize, caseParams, reportAppend)
+				if casePage != 0 {
+					curve = append(curve, &sweepPoint{Page: casePage, PageSize: casePageSize, Summary: summary})
+				}
+				reportAppend = true
+			}
+			r.reportSweep(testCase, curve, caseParams, profileName)
 		}
 
-		if len(keyword) != 0 || keyword != "" {
-			fmt.Printf("Calling API [%s] with keyword -> ", command)
-			params := generateParams(apiKey, secretKey, signatureVersion, expires, command, 0, 0, keyword)
-			executeAPIandCalculate(profileName, apiURL, command, params, iterations, 0, 0, keyword, dbProfile, reportAppend)
+		fmt.Printf("------------------------------------------------------------\n")
+		r.processedAPIs[testCase.Command] = true
+	}
+	return r.Summaries()[first:], nil
+}
+
+// Returns the page sizes to traverse the collection of the case with
+func traversePageSizes(testCase *scenario.Case, pagesizes []int) []int {
+	if len(testCase.PageSizes) > 0 {
+		return testCase.PageSizes
+	}
+	var sizes []int
+	for _, size := range pagesizes {
+		if size > 0 {
+			sizes = append(sizes, size)
 		}
+	}
+	if len(sizes) > 0 {
+		return sizes
+	}
+	return []int{defaultTraversePageSize}
+}
 
-		fmt.Printf("Calling API [%s] -> ", command)
-		params := generateParams(apiKey, secretKey, signatureVersion, expires, command, 0, 0, "")
-		executeAPIandCalculate(profileName, apiURL, command, params, iterations, 0, 0, "", dbProfile, reportAppend)
+/*
+Returns the page and pagesize of every run of the case, page 0 meaning without
+page parameters. Cases without pages or pagesizes are run with the page and
+each of the pagesizes of the configuration file, if any, and without page
+parameters.
+*/
+func pageMatrix(testCase *scenario.Case, page int, pagesizes []int) [][2]int {
+	if len(testCase.Pages) == 0 && len(testCase.PageSizes) == 0 {
+		var matrix [][2]int
+		if page != 0 {
+			for _, size := range pagesizes {
+				matrix = append(matrix, [2]int{page, size})
+			}
+		}
+		return append(matrix, [2]int{0, 0})
+	}
 
-		fmt.Printf("------------------------------------------------------------\n")
-		processedAPImap[command] = true
+	pages := testCase.Pages
+	if len(pages) == 0 {
+		pages = []int{1}
 	}
+	pageSizes := testCase.PageSizes
+	if len(pageSizes) == 0 {
+		pageSizes = pagesizes
+	}
+	var matrix [][2]int
+	for _, p := range pages {
+		if p == 0 {
+			matrix = append(matrix, [2]int{0, 0})
+			continue
+		}
+		for _, size := range pageSizes {
+			matrix = append(matrix, [2]int{p, size})
+		}
+	}
+	return matrix
 }
 
-func executeAPIandCalculate(profileName string, apiURL string, command string, params url.Values, iterations int, page int, pagesize int, keyword string, dbProfile int, reportAppend bool) {
-	var minTime = math.MaxFloat64
-	var maxTime = 0.0
-	var avgTime float64
-	var totalTime float64
-	var count float64
-	getRequestList := map[string]struct{}{"isaccountallowedtocreateofferingswithtags": {}, "readyforshutdown": {}, "cloudianisenabled": {}, "quotabalance": {}, 
-	"quotasummary": {}, "quotatarifflist": {}, "quotaisenabled": {}, "quotastatement": {}, "verifyoauthcodeandgetuser": {}}
-	_, isInGetRequestList := getRequestList[command]
-	isGetRequest, _ := regexp.MatchString("^(get|list|query|find)(\\w+)+$", command)
+/*
+Runs the API and saves the statistics of the run, which are returned unless the
+API was run in stages. newParams is called for every call so that the signature
+does not expire during long runs.
+
+Async commands are timed until their job is done, jobParams returns the
+parameters of the queryAsyncJobResult calls polling the job.
+
+The warm-up calls of the case, or of the options, are made one after the other
+before the measured calls and are left out of the statistics. The latency of
+the first call, warm-up or not, is reported as the cold start of the API.
+
+The API is called in one of the following ways:
+ 1. iterations calls by each of the concurrency clients (default)
+ 2. by each of the concurrency clients until duration has elapsed
+ 3. at a constant rate of calls/sec for duration, or for iterations calls
+ 4. by a number of clients following the stages, with a report row per stage
+*/
+func (r *Runner) executeAPIandCalculate(profileName string, client *http.Client, testCase *scenario.Case, newParams func() url.Values, jobParams func(jobId string) url.Values, iterations int, concurrency int, warmup int, page int, pagesize int, extraParams url.Values, reportAppend bool) *Summary {
+	apiURL := r.options.APIURL
+	duration := r.options.Duration
+	rate := r.options.Rate
+	stages := r.options.Stages
+	command := testCase.Command
+	postRequest := isPostRequest(command)
+
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	send := func(warmup bool) *apiResult {
+		elapsedTime, apicount, jobId, apiErr := r.executeAPI(profileName, client, newParams(), postRequest, warmup, testCase.Validate)
+		if jobId == "" {
+			return &apiResult{
+				Elapsed: elapsedTime,
+				Latency: elapsedTime,
+				Count:   apicount,
+				Success: apiErr == nil,
+				Error:   apiErr,
+			}
+		}
+
+		// Async commands take until their job is done
+		jobErr, queueTime := waitForJob(profileName, client, apiURL, command, jobParams, jobId, r.options.JobPollInterval, r.options.JobTimeout)
+		if !warmup {
+			r.updateStats(profileName, command, jobErr, elapsedTime+queueTime)
+		}
+		return &apiResult{
+			Elapsed:    elapsedTime + queueTime,
+			Latency:    elapsedTime + queueTime,
+			Count:      apicount,
+			Success:    jobErr == nil,
+			Error:      jobErr,
+			Async:      true,
+			SubmitTime: elapsedTime,
+			QueueTime:  queueTime,
+		}
+	}
+	call := func() *apiResult {
+		return send(false)
+	}
+
+	var coldStart *apiResult
+	if warmup > 0 {
+		log.Infof("Warming up the API %s with %d calls", command, warmup)
+		coldStart = warmUp(func() *apiResult { return send(true) }, warmup)
+	}
 
-	if iterations != 1 {
-		log.Infof("Calling API %s for %d number of iterations with parameters %s", command, iterations, params)
-		for i := 1; i <= iterations; i++ {
-			log.Infof("Started with iteration %d for the command %s", i, command)
-			elapsedTime, apicount, result := executeAPI(apiURL, params, !(isGetRequest || isInGetRequestList))
-			count = apicount
-			if elapsedTime < minTime {
-				minTime = elapsedTime
+	if len(stages) > 0 {
+		log.Infof("Calling API %s with stages %s and parameters %s", command, loadprofile.Format(stages), formatParams(extraParams))
+		results := runStages(call, stages)
+		// The cold start is reported with the first stage
+		reportedColdStart := false
+		for i, stage := range stages {
+			var stageResults []*apiResult
+			for _, result := range results {
+				if result.Stage == i+1 {
+					stageResults = append(stageResults, result)
+				}
 			}
-			if elapsedTime > maxTime {
-				maxTime = elapsedTime
+			if len(stageResults) == 0 {
+				log.Infof("No calls were made for the API %s in stage %d", command, i+1)
+				continue
 			}
-			totalTime += elapsedTime
-			if !result {
-				break
+			summary := calculateStats(stageResults, stage.Duration.Seconds())
+			summary.Concurrency = loadprofile.PeakClients(stages, i+1)
+			summary.Stage = strconv.Itoa(i + 1)
+			if !reportedColdStart {
+				setColdStart(summary, coldStart, stageResults, warmup)
+				reportedColdStart = true
 			}
+			log.Infof("Stage %d [%s to %d clients] count [%.f] : Time in seconds [Min - %.2f] [Max - %.2f] [Avg - %.2f] Throughput [%.2f calls/sec] Error rate [%.2f%%]\n",
+				i+1, stage.Duration, stage.Target, summary.Count, summary.MinTime, summary.MaxTime, summary.AvgTime, summary.Throughput, summary.ErrorRate)
+			r.checkExpectations(testCase, summary)
+			r.save(profileName, testCase, page, pagesize, extraParams, summary, reportAppend)
+			reportAppend = true
+		}
+		return nil
+	}
+
+	var results []*apiResult
+	start := time.Now()
+	if rate > 0 {
+		if duration > 0 {
+			log.Infof("Calling API %s at %.2f calls/sec for %s with parameters %s", command, rate, duration, formatParams(extraParams))
+		} else {
+			log.Infof("Calling API %s at %.2f calls/sec for %d calls with parameters %s", command, rate, iterations, formatParams(extraParams))
 		}
-		avgTime = totalTime / float64(iterations)
-		log.Infof("count [%.f] : Time in seconds [Min - %.2f] [Max - %.2f] [Avg - %.2f]\n", count, minTime, maxTime, avgTime)
-		saveData(apiURL, count, minTime, maxTime, avgTime, page, pagesize, keyword, profileName, command, dbProfile, reportAppend)
+		results = runAtRate(call, rate, iterations, duration)
 	} else {
-		elapsedTime, apicount, _ := executeAPI(apiURL, params, !(isGetRequest || isInGetRequestList))
-		log.Infof("Elapsed time [%.2f seconds] for the count [%.0f]", elapsedTime, apicount)
-		saveData(apiURL, count, elapsedTime, elapsedTime, elapsedTime, page, pagesize, keyword, profileName, command, dbProfile, reportAppend)
+		if duration > 0 {
+			log.Infof("Calling API %s for %s with %d concurrent clients and parameters %s", command, duration, concurrency, formatParams(extraParams))
+		} else {
+			log.Infof("Calling API %s for %d number of iterations with %d concurrent clients and parameters %s", command, iterations, concurrency, formatParams(extraParams))
+		}
+		results = runClients(call, concurrency, iterations, duration)
 	}
+	wallTime := time.Since(start).Seconds()
+
+	if len(results) == 0 {
+		log.Infof("No calls were made for the API %s", command)
+		return nil
+	}
+	summary := calculateStats(results, wallTime)
+	summary.Concurrency = concurrency
+	summary.TargetRate = rate
+	setColdStart(summary, coldStart, results, warmup)
+
+	log.Infof("count [%.f] : Time in seconds [Min - %.3f] [Max - %.3f] [Avg - %.3f] [Median - %.3f] [95th - %.3f] [99th - %.3f] [Cold start - %.3f] Throughput [%.2f calls/sec]\n",
+		summary.Count, summary.MinTime, summary.MaxTime, summary.AvgTime, summary.Median, summary.Percentile95, summary.Percentile99, summary.ColdStart, summary.Throughput)
+	if summary.AsyncJobs > 0 {
+		log.Infof("async jobs [%d] : Time in seconds [Avg submit - %.3f] [Avg queue - %.3f] [Avg completion - %.3f]", summary.AsyncJobs, summary.AvgSubmitTime, summary.AvgQueueTime, summary.AvgTime)
+	}
+	if rate > 0 {
+		log.Infof("Target rate [%.2f calls/sec] Achieved rate [%.2f calls/sec] Avg service time [%.2f] seconds", rate, summary.Throughput, summary.AvgServiceTime)
+		if summary.Throughput < rate*0.95 {
+			log.Warnf("API %s could not keep up with the target rate of %.2f calls/sec", command, rate)
+		}
+	}
+	r.checkExpectations(testCase, summary)
+	r.save(profileName, testCase, page, pagesize, extraParams, summary, reportAppend)
+	return summary
 }
 
-func saveData(apiURL string, count float64, minTime float64, maxTime float64, avgTime float64, page int, pageSize int, keyword string, user string, filename string, dbProfile int, reportAppend bool) {
+// Statistics of a set of calls to an API, as saved in the report
+type Summary struct {
+	// Profile and case the calls were made by
+	Profile string
+	Case    string
+	Command string
+	// Page and page size of the calls, Page is 0 if the calls were made without
+	// page parameters, and AllPages if they fetched the whole collection
+	Page     int
+	PageSize int
+	// Parameters of the case, with the placeholders resolved
+	Params url.Values
 
-	parsedURL, err := url.Parse(apiURL)
-	if err != nil {
-		log.Infof("Error parsing URL : %s with error : %s\n", apiURL, err)
-		return
+	// Number of calls made, Count being the number of items in the response
+	Calls          int
+	Count          float64
+	MinTime        float64
+	MaxTime        float64
+	AvgTime        float64
+	AvgServiceTime float64
+	Throughput     float64
+	ErrorRate      float64
+	TargetRate     float64
+	Median         float64
+	Percentile90   float64
+	Percentile95   float64
+	Percentile99   float64
+	Percentile999  float64
+	StdDev         float64
+	// Number of async jobs, and the average time taken to submit them and
+	// spent in the queue until they were done, the sum of both being the time
+	// of the call
+	AsyncJobs     int
+	AvgSubmitTime float64
+	AvgQueueTime  float64
+	Concurrency   int
+	// Number of warm-up calls made before the calls, which are left out of the
+	// statistics, and the latency of the first call, warm-up or not. ColdStart
+	// is 0 for the rows of the later stages of a run.
+	Warmup    int
+	ColdStart float64
+	// Stage of the calls, "-" if they were not run in stages
+	Stage string
+	// Expectations of the case that were not met, "-" if all of them were, or
+	// there were none
+	Expectations string
+	// Expectations of the case, nil if it has none
+	Expect    *scenario.Expect
+	Histogram *histogram.Histogram
+	// Errors of the failed calls, by kind
+	Errors *failure.Counter
+}
+
+// Sets the cold start of the summary to the latency of the first warm-up call, or of the first call if there were no warm-up calls
+func setColdStart(summary *Summary, coldStart *apiResult, results []*apiResult, warmup int) {
+	summary.Warmup = warmup
+	if coldStart == nil && len(results) > 0 {
+		coldStart = results[0]
+	}
+	if coldStart != nil {
+		summary.ColdStart = coldStart.Latency
 	}
-	host := parsedURL.Hostname()
+}
 
-	err = os.MkdirAll(fmt.Sprintf("report/accumulated/%s", host), 0755)
-	if err != nil {
-		log.Infof("Error creating host directory : report/accumulated/%s\n", host, err)
-		return
+// Calculates the statistics of the calls made over wallTime seconds
+func calculateStats(results []*apiResult, wallTime float64) *Summary {
+	summary := &Summary{
+		Errors:       failure.NewCounter(),
+		MinTime:      math.MaxFloat64,
+		Stage:        "-",
+		Expectations: "-",
+		Histogram:    histogram.New(histogram.DefaultBuckets),
 	}
+	var totalTime float64
+	var totalElapsed float64
+	var totalSubmit float64
+	var totalQueue float64
+	var latencies stats.Float64Data
+	failed := 0
+	for _, result := range results {
+		latencies = append(latencies, result.Latency)
+		summary.Histogram.Observe(result.Latency)
+		summary.Count = result.Count
+		if result.Latency < summary.MinTime {
+			summary.MinTime = result.Latency
+		}
+		if result.Latency > summary.MaxTime {
+			summary.MaxTime = result.Latency
+		}
+		totalTime += result.Latency
+		totalElapsed += result.Elapsed
+		if !result.Success {
+			failed++
+			summary.Errors.Add(result.Error)
+		}
+		if result.Async {
+			summary.AsyncJobs++
+			totalSubmit += result.SubmitTime
+			totalQueue += result.QueueTime
+		}
+	}
+	if summary.AsyncJobs > 0 {
+		summary.AvgSubmitTime = totalSubmit / float64(summary.AsyncJobs)
+		summary.AvgQueueTime = totalQueue / float64(summary.AsyncJobs)
+	}
+	summary.Calls = len(results)
+	summary.AvgTime = totalTime / float64(len(results))
+	summary.AvgServiceTime = totalElapsed / float64(len(results))
+	summary.ErrorRate = float64(failed) * 100 / float64(len(results))
+	summary.Median, _ = latencies.Median()
+	summary.Percentile90, _ = latencies.Percentile(90)
+	summary.Percentile95, _ = latencies.Percentile(95)
+	summary.Percentile99, _ = latencies.Percentile(99)
+	summary.Percentile999, _ = latencies.Percentile(99.9)
+	summary.StdDev, _ = latencies.StandardDeviation()
+	if wallTime > 0 {
+		summary.Throughput = float64(len(results)) / wallTime
+	}
+	return summary
+}
+
+/*
+Adds the statistics of a run of the case to the ones of the runner, and saves
+them to the report of the API, unless the options have no report directory.
+*/
+func (r *Runner) save(profileName string, testCase *scenario.Case, page int, pageSize int, extraParams url.Values, summary *Summary, reportAppend bool) {
+	summary.Profile = profileName
+	summary.Case = testCase.Name
+	summary.Command = testCase.Command
+	summary.Page = page
+	summary.PageSize = pageSize
+	summary.Params = extraParams
+	summary.Expect = testCase.Expect
+	r.lock.Lock()
+	r.summaries = append(r.summaries, summary)
+	r.lock.Unlock()
+
+	if r.options.ReportDir != "" {
+		r.saveData(summary, page, pageSize, extraParams, profileName, testCase, reportAppend)
+	}
+}
 
-	err = os.MkdirAll(fmt.Sprintf("report/individual/%s", host), 0755)
+func (r *Runner) saveData(summary *Summary, page int, pageSize int, extraParams url.Values, user string, testCase *scenario.Case, reportAppend bool) {
+	apiURL := r.options.APIURL
+	reportDir := r.options.ReportDir
+	dbProfile := r.options.DBProfile
+	filename := testCase.Command
+
+	err := os.MkdirAll(reportDir, 0755)
 	if err != nil {
-		log.Infof("Error creating host directory : report/individual/%s\n", host, err)
+		log.Infof("Error creating the report directory : %s with error %s\n", reportDir, err)
 		return
 	}
 
@@ -185,139 +761,291 @@ func saveData(apiURL string, count float64, minTime float64, maxTime float64, av
 		fileMode |= os.O_TRUNC
 	}
 
-	individualFile, err := os.OpenFile(fmt.Sprintf("report/individual/%s/%s.csv", host, filename), fileMode, 0644)
+	fileName := filepath.Join(reportDir, filename+".csv")
+	file, err := os.OpenFile(fileName, fileMode, 0644)
 	if err != nil {
-		log.Fatalf("Error opening the file CSV : report/individual/%s/%s.csv with error %s\n", host, filename, apiURL, err)
-	}
-	defer individualFile.Close()
-
-	accumulatedFile, err := os.OpenFile(fmt.Sprintf("report/accumulated/%s/%s.csv", host, filename), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
-	if err != nil {
-		log.Fatalf("Error opening the file CSV : report/accumulated/%s/%s.csv with error %s\n", host, filename, apiURL, err)
+		log.Errorf("Error opening the file CSV : %s with error %s\n", fileName, err)
+		return
 	}
-	defer accumulatedFile.Close()
-
-	filePointers := []*os.File{individualFile, accumulatedFile}
-	for _, file := range filePointers {
-		writer := csv.NewWriter(file)
-		defer writer.Flush()
+	defer file.Close()
 
-		filereader, err := os.Open(file.Name())
-		if err != nil {
-			log.Fatalf("Error opening the file CSV : %s with error %s\n", file.Name(), err)
-		}
-		defer filereader.Close()
-		reader := bufio.NewReader(filereader)
-		firstLine, _ := reader.ReadString('\n')
-		containsCount := strings.Contains(strings.ToLower(firstLine), "count")
-
-		if !containsCount {
-			header := []string{"Count", "MinTime", "MaxTime", "AvgTime", "Page", "PageSize", "keyword", "User", "DBprofile"}
-			err = writer.Write(header)
-			if err != nil {
-				log.Infof("Error writing CSV header for the API: %s with error %s\n", apiURL, err)
-				return
-			}
-		}
+	writer := csv.NewWriter(file)
+	defer writer.Flush()
 
-		var record []string
-		if page != 0 {
-			record = []string{
-				fmt.Sprintf("%.f", count),
-				fmt.Sprintf("%.2f", minTime),
-				fmt.Sprintf("%.2f", maxTime),
-				fmt.Sprintf("%.2f", avgTime),
-				strconv.Itoa(page),
-				strconv.Itoa(pageSize),
-				keyword,
-				user,
-				strconv.Itoa(dbProfile),
-			}
-		} else {
-			record = []string{
-				fmt.Sprintf("%.f", count),
-				fmt.Sprintf("%.2f", minTime),
-				fmt.Sprintf("%.2f", maxTime),
-				fmt.Sprintf("%.2f", avgTime),
-				"-",
-				"-",
-				keyword,
-				user,
-				strconv.Itoa(dbProfile),
-			}
-		}
-		err = writer.Write(record)
+	if !reportAppend {
+		header := []string{"Count", "MinTime", "MaxTime", "AvgTime", "Page", "PageSize", "keyword", "User", "DBprofile", "Concurrency", "Throughput", "TargetRate", "ErrorRate", "Stage",
+			"Median", "90thPercentile", "95thPercentile", "99thPercentile", "99.9thPercentile", "StdDev", "Params", "Case", "Expectations",
+			"AsyncJobs", "AvgSubmitTime", "AvgQueueTime", "TopErrors", "Calls", "Run", "Warmup", "ColdStart"}
+		err = writer.Write(header)
 		if err != nil {
-			log.Infof("Error writing to CSV for the API: %s with error %s\n", apiURL, err)
+			log.Infof("Error writing CSV header for the API: %s with error %s\n", apiURL, err)
 			return
 		}
 	}
 
-	message := fmt.Sprintf("Data saved to report/%s/%s.csv successfully.\n", host, filename)
+	pageValue, pageSizeValue := PageColumns(page, pageSize)
+	record := []string{
+		fmt.Sprintf("%.f", summary.Count),
+		fmt.Sprintf("%.3f", summary.MinTime),
+		fmt.Sprintf("%.3f", summary.MaxTime),
+		fmt.Sprintf("%.3f", summary.AvgTime),
+		pageValue,
+		pageSizeValue,
+		extraParams.Get("keyword"),
+		user,
+		strconv.Itoa(dbProfile),
+		strconv.Itoa(summary.Concurrency),
+		fmt.Sprintf("%.2f", summary.Throughput),
+		fmt.Sprintf("%.2f", summary.TargetRate),
+		fmt.Sprintf("%.2f", summary.ErrorRate),
+		summary.Stage,
+		fmt.Sprintf("%.3f", summary.Median),
+		fmt.Sprintf("%.3f", summary.Percentile90),
+		fmt.Sprintf("%.3f", summary.Percentile95),
+		fmt.Sprintf("%.3f", summary.Percentile99),
+		fmt.Sprintf("%.3f", summary.Percentile999),
+		fmt.Sprintf("%.3f", summary.StdDev),
+		formatParams(extraParams, "keyword"),
+		testCase.Name,
+		summary.Expectations,
+	}
+	if summary.AsyncJobs > 0 {
+		record = append(record, strconv.Itoa(summary.AsyncJobs), fmt.Sprintf("%.3f", summary.AvgSubmitTime), fmt.Sprintf("%.3f", summary.AvgQueueTime))
+	} else {
+		record = append(record, "0", "-", "-")
+	}
+	record = append(record, summary.Errors.Summary(topErrors), strconv.Itoa(summary.Calls), runColumn(r.options.Run), strconv.Itoa(summary.Warmup), ColdStartColumn(summary.ColdStart))
+	err = writer.Write(record)
+	if err != nil {
+		log.Infof("Error writing to CSV for the API: %s with error %s\n", apiURL, err)
+		return
+	}
+
+	saveHistogram(reportDir, summary, page, pageSize, extraParams, user, testCase, dbProfile, r.options.Run, reportAppend)
+
+	message := fmt.Sprintf("Data saved to %s successfully.\n", fileName)
 	log.Info(message)
 }
 
-func executeAPI(apiURL string, params url.Values, postRequest bool) (float64, float64, bool) {
+// Returns the Run column of the report, "-" if the run has no id
+func runColumn(run string) string {
+	if run == "" {
+		return "-"
+	}
+	return run
+}
+
+// Returns the ColdStart column of the report, "-" for the rows without a cold start
+func ColdStartColumn(coldStart float64) string {
+	if coldStart == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.3f", coldStart)
+}
+
+// Returns the Page and PageSize columns of the report, "all" pages for traversals
+func PageColumns(page int, pageSize int) (string, string) {
+	switch page {
+	case 0:
+		return "-", "-"
+	case AllPages:
+		return "all", strconv.Itoa(pageSize)
+	default:
+		return strconv.Itoa(page), strconv.Itoa(pageSize)
+	}
+}
+
+/*
+Saves the latency histogram next to the report of the API, in <API>-histogram.csv.
+Every row matches a row of the report and has the number of calls in each bucket,
+the bucket columns are named after the upper bound of the bucket in seconds.
+*/
+func saveHistogram(reportDir string, summary *Summary, page int, pageSize int, extraParams url.Values, user string, testCase *scenario.Case, dbProfile int, run string, reportAppend bool) {
+	fileName := filepath.Join(reportDir, testCase.Command+"-histogram.csv")
+	fileMode := os.O_WRONLY | os.O_CREATE
+	if reportAppend {
+		fileMode |= os.O_APPEND
+	} else {
+		fileMode |= os.O_TRUNC
+	}
+	file, err := os.OpenFile(fileName, fileMode, 0644)
+	if err != nil {
+		log.Errorf("Error opening the file CSV : %s with error %s\n", fileName, err)
+		return
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	if !reportAppend {
+		header := []string{"Page", "PageSize", "keyword", "User", "DBprofile", "Stage", "Params", "Case", "Run"}
+		writer.Write(append(header, summary.Histogram.Labels()...))
+	}
+
+	pageValue, pageSizeValue := PageColumns(page, pageSize)
+	record := []string{pageValue, pageSizeValue, extraParams.Get("keyword"), user, strconv.Itoa(dbProfile), summary.Stage, formatParams(extraParams, "keyword"), testCase.Name, runColumn(run)}
+	for _, count := range summary.Histogram.Counts() {
+		record = append(record, strconv.FormatUint(count, 10))
+	}
+	writer.Write(record)
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		log.Errorf("Error writing the histogram for the API %s with error %s\n", testCase.Command, err)
+	}
+}
+
+// Returns whether the API is sent as a POST request, only APIs reading data are sent as GET requests
+func isPostRequest(command string) bool {
+	getRequestList := map[string]struct{}{"isaccountallowedtocreateofferingswithtags": {}, "readyforshutdown": {}, "cloudianisenabled": {}, "quotabalance": {},
+		"quotasummary": {}, "quotatarifflist": {}, "quotaisenabled": {}, "quotastatement": {}, "verifyoauthcodeandgetuser": {}}
+	_, isInGetRequestList := getRequestList[command]
+	isGetRequest, _ := regexp.MatchString("^(get|list|query|find)(\\w+)+$", command)
+	return !(isGetRequest || isInGetRequestList)
+}
+
+/*
+Sends the call and returns the time taken, the count of the response and the
+error of the call if it failed. Async commands return the id of their job
+instead of a count, the job is left to the caller to wait for and count in the
+statistics. Warm-up calls are not counted in the statistics of the runner.
+
+The response is checked against the rules, if any, and the call fails if it
+breaks any of them.
+*/
+func (r *Runner) executeAPI(profileName string, client *http.Client, params url.Values, postRequest bool, warmup bool, rules *scenario.Validate) (float64, float64, string, *failure.Error) {
 	// Send the API request and calculate the time
+	apiURL := r.options.APIURL
 	var resp *http.Response
+	var body []byte
 	var err error
+	command := params.Get("command")
 	log.Infof("Running the API %s", apiURL)
+	done := metrics.StartRequest(profileName)
+	defer done()
 	start := time.Now()
+	defer func() {
+		recordSample(profileName, params, start, resp, body, err, warmup)
+	}()
+	updateStats := func(apiErr *failure.Error, elapsed float64) {
+		if !warmup {
+			r.updateStats(profileName, command, apiErr, elapsed)
+		}
+	}
 	if postRequest {
 		dataBody := strings.NewReader(params.Encode())
-		resp, err = http.Post(
+		resp, err = client.Post(
 			apiURL,
 			"application/x-www-form-urlencoded",
 			dataBody,
 		)
 	} else {
-		apiURL = fmt.Sprintf("%s?%s", apiURL, params.Encode())
-		resp, err = http.Get(apiURL)
+		resp, err = client.Get(fmt.Sprintf("%s?%s", apiURL, params.Encode()))
 	}
 
-	APIscount++
 	if err != nil {
-		log.Infof("Error sending API request: %s with error %s\n", apiURL, err)
-		FailedAPIs++
-		return 0, 0, false
+		log.Infof("Error sending API request: %s %s with error %s\n", apiURL, command, failure.Message(err))
+		apiErr := failure.FromError(command, err)
+		// Timed out calls took at least as long as the timeout
+		elapsed := time.Since(start)
+		updateStats(apiErr, elapsed.Seconds())
+		return elapsed.Seconds(), 0, "", apiErr
 	}
 	defer resp.Body.Close()
 	elapsed := time.Since(start)
-	TotalTime += elapsed.Seconds()
 
-	body, err := ioutil.ReadAll(resp.Body)
+	body, err = ioutil.ReadAll(resp.Body)
 	if err != nil {
-		log.Infof("Error reading API response: %s with error %s\n", apiURL, err)
-		FailedAPIs++
-		return 0, 0, false
+		log.Infof("Error reading API response: %s %s with error %s\n", apiURL, command, failure.Message(err))
+		apiErr := failure.FromError(command, err)
+		elapsed = time.Since(start)
+		updateStats(apiErr, elapsed.Seconds())
+		return elapsed.Seconds(), 0, "", apiErr
 	}
 
 	var data map[string]interface{}
 	err = json.Unmarshal([]byte(body), &data)
 	if err != nil {
-		log.Infof("Error parsing JSON for the API response: %s with error %s\n", apiURL, err)
-		FailedAPIs++
-		return 0, 0, false
-	}
-	var key string
-	for k := range data {
-		key = k
-		break
+		log.Infof("Error parsing JSON for the API response: %s %s with error %s\n", apiURL, command, failure.Message(err))
+		apiErr := failure.New(command, failure.Parse, 0, err.Error())
+		if resp.StatusCode >= 400 {
+			apiErr = failure.New(command, failure.HTTPStatus, resp.StatusCode, http.StatusText(resp.StatusCode))
+		}
+		updateStats(apiErr, elapsed.Seconds())
+		return elapsed.Seconds(), 0, "", apiErr
 	}
-
-	count, ok := data[key].(map[string]interface{})["count"].(float64)
+	response := responseBody(data, command)
+	count, ok := response["count"].(float64)
 	if !ok {
-		errorCode, ok := data[key].(map[string]interface{})["errorcode"].(float64)
+		errorCode, ok := response["errorcode"].(float64)
 		if ok {
-			errorText := data[key].(map[string]interface{})["errortext"].(string)
+			errorText, _ := response["errortext"].(string)
 			log.Infof(" [Error] while calling the API ErrorCode[%.0f] ErrorText[%s]", errorCode, errorText)
-			FailedAPIs++
-			return elapsed.Seconds(), count, false
+			apiErr := failure.New(command, failure.CloudStack, int(errorCode), errorText)
+			updateStats(apiErr, elapsed.Seconds())
+			return elapsed.Seconds(), count, "", apiErr
+		}
+		if jobId, ok := response["jobid"].(string); ok {
+			return elapsed.Seconds(), count, jobId, nil
 		}
 	}
+	if resp.StatusCode >= 400 {
+		apiErr := failure.New(command, failure.HTTPStatus, resp.StatusCode, http.StatusText(resp.StatusCode))
+		updateStats(apiErr, elapsed.Seconds())
+		return elapsed.Seconds(), count, "", apiErr
+	}
+	page, _ := strconv.Atoi(params.Get("page"))
+	pageSize, _ := strconv.Atoi(params.Get("pagesize"))
+	if violations := rules.Check(response, page, pageSize); len(violations) > 0 {
+		log.Infof(" [Error] invalid response of the API %s with count %.f: %s", command, count, strings.Join(violations, "; "))
+		apiErr := failure.New(command, failure.Validation, 0, strings.Join(violations, "; "))
+		updateStats(apiErr, elapsed.Seconds())
+		return elapsed.Seconds(), count, "", apiErr
+	}
+
+	updateStats(nil, elapsed.Seconds())
+	return elapsed.Seconds(), count, "", nil
+}
+
+// Returns the body of the response of the command, the object of its
+// <command>response key, or of the first response key if there is no such key
+func responseBody(data map[string]interface{}, command string) map[string]interface{} {
+	if body, ok := data[strings.ToLower(command)+"response"].(map[string]interface{}); ok {
+		return body
+	}
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if body, ok := data[key].(map[string]interface{}); ok && strings.HasSuffix(key, "response") {
+			return body
+		}
+	}
+	return nil
+}
 
-	SuccessAPIs++
-	return elapsed.Seconds(), count, true
+// Saves the call to the samples file, if enabled
+func recordSample(profileName string, params url.Values, start time.Time, resp *http.Response, body []byte, err error, warmup bool) {
+	if !samples.Enabled() {
+		return
+	}
+	sample := &samples.Sample{
+		Timestamp: start,
+		Command:   params.Get("command"),
+		Profile:   profileName,
+		Params:    samples.Redact(params),
+		Bytes:     len(body),
+		Duration:  time.Since(start).Seconds(),
+		Warmup:    warmup,
+	}
+	if resp != nil {
+		sample.Status = resp.StatusCode
+	}
+	sample.ErrorCode, sample.ErrorText, sample.Items = samples.ParseResponse(body)
+	if err != nil {
+		sample.ErrorText = failure.Message(err)
+	}
+	samples.Record(sample)
 }
 
 func generateSignature(unsignedRequest string, secretKey string) string {
@@ -330,34 +1058,3 @@ func generateSignature(unsignedRequest string, secretKey string) string {
 
 	return computedSignature
 }
-
-func readCommandsFromFile(filename string) ([]string, map[string]string, error) {
-	file, err := os.Open(filename)
-	if err != nil {
-		return nil, nil, err
-	}
-	defer file.Close()
-
-	var commands []string
-	var commandsKeywordMap = make(map[string]string)
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		keyword := ""
-		if strings.Contains(line, "keyword=") {
-			keywordStartIndex := strings.Index(line, "keyword=")
-			keyword = strings.TrimSpace(line[keywordStartIndex+8:])
-			line = strings.TrimSpace(line[:keywordStartIndex])
-		}
-		if line != "" {
-			commands = append(commands, line)
-			commandsKeywordMap[line] = keyword
-		}
-	}
-
-	if err := scanner.Err(); err != nil {
-		return nil, nil, err
-	}
-
-	return commands, commandsKeywordMap, nil
-}
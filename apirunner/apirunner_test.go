@@ -0,0 +1,332 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apirunner
+
+import (
+	"csbench/config"
+	"csbench/failure"
+	"csbench/scenario"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Returns the results of successful calls with the latencies
+func results(latencies ...float64) []*apiResult {
+	var results []*apiResult
+	for _, latency := range latencies {
+		results = append(results, &apiResult{Elapsed: latency, Latency: latency, Count: 10, Success: true})
+	}
+	return results
+}
+
+func TestCalculateStats(t *testing.T) {
+	var hundred []float64
+	for i := 1; i <= 100; i++ {
+		hundred = append(hundred, float64(i)/100)
+	}
+	failed := results(0.1, 0.2, 0.3, 0.4)
+	failed[3].Success = false
+	failed[3].Error = failure.New("listZones", failure.Timeout, 0, "timed out")
+	async := results(0.1, 0.3)
+	for _, result := range async {
+		result.Async, result.SubmitTime, result.QueueTime = true, 0.05, result.Latency-0.05
+	}
+
+	// The percentiles between two latencies are their average, so that the
+	// high percentiles of a few calls are below the slowest one
+	tests := []struct {
+		name     string
+		results  []*apiResult
+		wallTime float64
+		want     Summary
+	}{
+		{"one call", results(0.2), 1, Summary{Calls: 1, Count: 10, MinTime: 0.2, MaxTime: 0.2, AvgTime: 0.2, AvgServiceTime: 0.2,
+			Throughput: 1, Median: 0.2, Percentile90: 0.2, Percentile95: 0.2, Percentile99: 0.2, Percentile999: 0.2}},
+		{"hundred calls", results(hundred...), 10, Summary{Calls: 100, Count: 10, MinTime: 0.01, MaxTime: 1, AvgTime: 0.505, AvgServiceTime: 0.505,
+			Throughput: 10, Median: 0.505, Percentile90: 0.9, Percentile95: 0.95, Percentile99: 0.99, Percentile999: 0.995, StdDev: 0.2887}},
+		{"failed call", failed, 0, Summary{Calls: 4, Count: 10, MinTime: 0.1, MaxTime: 0.4, AvgTime: 0.25, AvgServiceTime: 0.25,
+			ErrorRate: 25, Median: 0.25, Percentile90: 0.35, Percentile95: 0.35, Percentile99: 0.35, Percentile999: 0.35, StdDev: 0.1118}},
+		{"async jobs", async, 0, Summary{Calls: 2, Count: 10, MinTime: 0.1, MaxTime: 0.3, AvgTime: 0.2, AvgServiceTime: 0.2,
+			Median: 0.2, Percentile90: 0.2, Percentile95: 0.2, Percentile99: 0.2, Percentile999: 0.2, StdDev: 0.1,
+			AsyncJobs: 2, AvgSubmitTime: 0.05, AvgQueueTime: 0.15}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			summary := calculateStats(test.results, test.wallTime)
+			values := []struct {
+				name      string
+				got, want float64
+			}{
+				{"Calls", float64(summary.Calls), float64(test.want.Calls)},
+				{"Count", summary.Count, test.want.Count},
+				{"MinTime", summary.MinTime, test.want.MinTime},
+				{"MaxTime", summary.MaxTime, test.want.MaxTime},
+				{"AvgTime", summary.AvgTime, test.want.AvgTime},
+				{"AvgServiceTime", summary.AvgServiceTime, test.want.AvgServiceTime},
+				{"Throughput", summary.Throughput, test.want.Throughput},
+				{"ErrorRate", summary.ErrorRate, test.want.ErrorRate},
+				{"Median", summary.Median, test.want.Median},
+				{"Percentile90", summary.Percentile90, test.want.Percentile90},
+				{"Percentile95", summary.Percentile95, test.want.Percentile95},
+				{"Percentile99", summary.Percentile99, test.want.Percentile99},
+				{"Percentile999", summary.Percentile999, test.want.Percentile999},
+				{"StdDev", summary.StdDev, test.want.StdDev},
+				{"AsyncJobs", float64(summary.AsyncJobs), float64(test.want.AsyncJobs)},
+				{"AvgSubmitTime", summary.AvgSubmitTime, test.want.AvgSubmitTime},
+				{"AvgQueueTime", summary.AvgQueueTime, test.want.AvgQueueTime},
+			}
+			for _, value := range values {
+				if math.Abs(value.got-value.want) > 0.0001 {
+					t.Errorf("%s = %g, want %g", value.name, value.got, value.want)
+				}
+			}
+			if count := summary.Histogram.Count(); count != uint64(len(test.results)) {
+				t.Errorf("histogram count = %d, want %d", count, len(test.results))
+			}
+			if total := summary.Errors.Total(); total != int(test.want.ErrorRate)*summary.Calls/100 {
+				t.Errorf("errors = %d, want %d", total, int(test.want.ErrorRate)*summary.Calls/100)
+			}
+		})
+	}
+}
+
+// A management server answering listZones, listHosts with an error, and the
+// async deployVirtualMachine, whose jobs are done at their second poll
+type managementServer struct {
+	*httptest.Server
+	lock  sync.Mutex
+	calls map[string]int
+	polls map[string]int
+}
+
+func newManagementServer(t *testing.T) *managementServer {
+	t.Helper()
+	server := &managementServer{calls: make(map[string]int), polls: make(map[string]int)}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if err := req.ParseForm(); err != nil {
+			t.Errorf("invalid request: %s", err)
+		}
+		command := req.Form.Get("command")
+		if req.Form.Get("apiKey") != "key" || req.Form.Get("signature") == "" {
+			t.Errorf("%s called without the API key and signature", command)
+		}
+		server.lock.Lock()
+		server.calls[command]++
+		jobs := server.calls["deployVirtualMachine"]
+		server.polls[req.Form.Get("jobid")]++
+		polls := server.polls[req.Form.Get("jobid")]
+		server.lock.Unlock()
+
+		switch command {
+		case "listZones":
+			fmt.Fprint(w, `{"listzonesresponse":{"count":2,"zone":[{"id":"z1"},{"id":"z2"}]}}`)
+		case "listHosts":
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"listhostsresponse":{"errorcode":401,"errortext":"unable to verify user credentials"}}`)
+		case "deployVirtualMachine":
+			if req.Method != http.MethodPost {
+				t.Errorf("%s sent as %s, want POST", command, req.Method)
+			}
+			fmt.Fprintf(w, `{"deployvirtualmachineresponse":{"id":"vm%d","jobid":"job%d"}}`, jobs, jobs)
+		case "queryAsyncJobResult":
+			status := 0
+			if polls > 1 {
+				status = 1
+			}
+			fmt.Fprintf(w, `{"queryasyncjobresultresponse":{"jobid":%q,"jobstatus":%d,"jobresult":{}}}`, req.Form.Get("jobid"), status)
+		default:
+			t.Errorf("unexpected command %s", command)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func (s *managementServer) called(command string) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.calls[command]
+}
+
+var adminProfile = &config.Profile{Name: "admin", ApiKey: "key", SecretKey: "secret", Expires: 600, SignatureVersion: 3}
+
+func TestRun(t *testing.T) {
+	server := newManagementServer(t)
+	runner := New(Options{
+		APIURL:          server.URL,
+		HTTPClient:      server.Client(),
+		Scenario:        &scenario.Scenario{Cases: []*scenario.Case{{Command: "listZones"}, {Command: "listHosts"}, {Command: "deployVirtualMachine"}}},
+		Iterations:      3,
+		Concurrency:     2,
+		JobPollInterval: 10 * time.Millisecond,
+	})
+	summaries, err := runner.Run(adminProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		command    string
+		calls      int
+		errorRate  float64
+		asyncJobs  int
+		serverHits int
+	}{
+		{"listZones", 6, 0, 0, 6},
+		// A client stops at its first failure
+		{"listHosts", 2, 100, 0, 2},
+		{"deployVirtualMachine", 6, 0, 6, 6},
+	}
+	if len(summaries) != len(tests) {
+		t.Fatalf("Run() returned %d summaries, want %d", len(summaries), len(tests))
+	}
+	for i, test := range tests {
+		summary := summaries[i]
+		if summary.Command != test.command || summary.Profile != "admin" {
+			t.Errorf("summary %d is of %s by %s, want %s by admin", i, summary.Command, summary.Profile, test.command)
+		}
+		if summary.Calls != test.calls || summary.ErrorRate != test.errorRate || summary.AsyncJobs != test.asyncJobs {
+			t.Errorf("%s: %d calls, error rate %g, %d async jobs, want %d, %g, %d", test.command,
+				summary.Calls, summary.ErrorRate, summary.AsyncJobs, test.calls, test.errorRate, test.asyncJobs)
+		}
+		if hits := server.called(test.command); hits != test.serverHits {
+			t.Errorf("%s called %d times, want %d", test.command, hits, test.serverHits)
+		}
+	}
+	if summaries[0].Count != 2 {
+		t.Errorf("listZones count = %g, want 2", summaries[0].Count)
+	}
+	if top := summaries[1].Errors.Top(1); len(top) != 1 || top[0].Error.Category != failure.CloudStack || top[0].Error.Code != 401 {
+		t.Errorf("listHosts errors = %v, want the CloudStack error 401", summaries[1].Errors.Summary(3))
+	}
+	// Every job is polled until its second poll sees it done
+	if polls := server.called("queryAsyncJobResult"); polls != 12 {
+		t.Errorf("queryAsyncJobResult called %d times, want 12", polls)
+	}
+	if deploy := summaries[2]; deploy.AvgQueueTime < 0.01 || deploy.AvgTime < deploy.AvgSubmitTime+deploy.AvgQueueTime-0.0001 {
+		t.Errorf("deployVirtualMachine average time %.3fs, submit %.3fs, queue %.3fs, want a queue of at least one poll interval",
+			deploy.AvgTime, deploy.AvgSubmitTime, deploy.AvgQueueTime)
+	}
+	if stats := runner.Stats(); stats.Calls != 14 || stats.Failed != 2 {
+		t.Errorf("Stats() = %d calls, %d failed, want 14 and 2", stats.Calls, stats.Failed)
+	}
+}
+
+func TestRunWarmup(t *testing.T) {
+	tests := []struct {
+		name     string
+		testCase *scenario.Case
+		calls    int
+		polls    int
+	}{
+		{"sync", &scenario.Case{Command: "listZones", Warmup: 2}, 5, 0},
+		// The warm-up jobs are waited for as well
+		{"async", &scenario.Case{Command: "deployVirtualMachine", Warmup: 2}, 5, 10},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newManagementServer(t)
+			runner := New(Options{
+				APIURL:          server.URL,
+				HTTPClient:      server.Client(),
+				Scenario:        &scenario.Scenario{Cases: []*scenario.Case{test.testCase}},
+				Iterations:      3,
+				Concurrency:     1,
+				JobPollInterval: 10 * time.Millisecond,
+			})
+			summaries, err := runner.Run(adminProfile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if hits := server.called(test.testCase.Command); hits != test.calls {
+				t.Errorf("%s called %d times, want %d", test.testCase.Command, hits, test.calls)
+			}
+			if polls := server.called("queryAsyncJobResult"); polls != test.polls {
+				t.Errorf("queryAsyncJobResult called %d times, want %d", polls, test.polls)
+			}
+			// The warm-up calls are left out of the statistics
+			summary := summaries[0]
+			if summary.Calls != 3 || summary.Warmup != 2 || summary.ColdStart <= 0 {
+				t.Errorf("%d calls, %d warm-up calls, cold start %.3fs, want 3, 2 and the first warm-up call", summary.Calls, summary.Warmup, summary.ColdStart)
+			}
+			if summary.Histogram.Count() != 3 {
+				t.Errorf("histogram of %d calls, want 3", summary.Histogram.Count())
+			}
+			if stats := runner.Stats(); stats.Calls != 3 {
+				t.Errorf("Stats() = %d calls, want 3", stats.Calls)
+			}
+		})
+	}
+}
+
+func TestExecuteAPIErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		delay    time.Duration
+		category failure.Category
+		code     int
+	}{
+		{"success", http.StatusOK, `{"listzonesresponse":{"count":1,"zone":[{"id":"z1"}]}}`, 0, "", 0},
+		{"CloudStack error", http.StatusUnauthorized, `{"listzonesresponse":{"errorcode":401,"errortext":"unable to verify user credentials"}}`, 0, failure.CloudStack, 401},
+		{"HTTP error", http.StatusBadGateway, `<html>Bad Gateway</html>`, 0, failure.HTTPStatus, 502},
+		{"invalid JSON", http.StatusOK, `{"listzonesresponse":`, 0, failure.Parse, 0},
+		{"timeout", http.StatusOK, `{}`, 200 * time.Millisecond, failure.Timeout, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				time.Sleep(test.delay)
+				w.WriteHeader(test.status)
+				fmt.Fprint(w, test.body)
+			}))
+			defer server.Close()
+			client := server.Client()
+			client.Timeout = 50 * time.Millisecond
+			runner := New(Options{APIURL: server.URL, HTTPClient: client})
+
+			params := signParams("key", "secret", 3, 600, commandParams("listZones", 0, 0, nil))
+			elapsed, _, _, apiErr := runner.executeAPI("admin", client, params, false, false, nil)
+			if test.category == "" {
+				if apiErr != nil {
+					t.Fatalf("executeAPI() error = %v, want none", apiErr)
+				}
+			} else if apiErr == nil || apiErr.Category != test.category || apiErr.Code != test.code {
+				t.Fatalf("executeAPI() error = %v, want %s %d", apiErr, test.category, test.code)
+			}
+			// Failed calls are timed as well, a timeout for at least the timeout
+			if elapsed <= 0 || (test.delay > 0 && elapsed < client.Timeout.Seconds()) {
+				t.Errorf("executeAPI() took %.3fs", elapsed)
+			}
+			stats := runner.Stats()
+			if stats.Calls != 1 || (stats.Failed == 1) != (test.category != "") {
+				t.Errorf("Stats() = %d calls, %d failed", stats.Calls, stats.Failed)
+			}
+			if apiErr != nil && strings.Contains(apiErr.Message, "signature") {
+				t.Errorf("error message %q has the signed query", apiErr.Message)
+			}
+		})
+	}
+}
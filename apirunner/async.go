@@ -0,0 +1,120 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apirunner
+
+import (
+	"csbench/failure"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Status of an async job in the response of queryAsyncJobResult
+const (
+	jobPending   = 0
+	jobSucceeded = 1
+	jobFailed    = 2
+)
+
+// The state of an async job in the response of queryAsyncJobResult
+type jobState struct {
+	Status    int
+	ErrorCode int
+	ErrorText string
+}
+
+/*
+Polls queryAsyncJobResult right away, and then every pollInterval, until the job
+of the command is done, or until timeout has elapsed. Returns the error of the
+job if it failed, and the time in seconds from the response of the command,
+right before the call to this function, until the poll that saw the job done.
+It is measured with the wall clock, as the dates of the job are to the second
+and leave out the time it was queued for.
+*/
+func waitForJob(profileName string, client *http.Client, apiURL string, command string, jobParams func(jobId string) url.Values, jobId string, pollInterval time.Duration, timeout time.Duration) (*failure.Error, float64) {
+	start := time.Now()
+	for {
+		job, err := queryJob(profileName, client, apiURL, jobParams(jobId))
+		if err != nil {
+			log.Infof("Error querying the async job %s: %s", jobId, failure.Message(err))
+		}
+		switch job.Status {
+		case jobSucceeded:
+			return nil, time.Since(start).Seconds()
+		case jobFailed:
+			log.Infof(" [Error] async job %s failed: %s", jobId, job.ErrorText)
+			return failure.New(command, failure.CloudStack, job.ErrorCode, job.ErrorText), time.Since(start).Seconds()
+		}
+		if time.Since(start) > timeout {
+			log.Warnf("Gave up waiting for the async job %s after %s", jobId, timeout)
+			return failure.New(command, failure.Timeout, 0, fmt.Sprintf("async job not done after %s", timeout)), time.Since(start).Seconds()
+		}
+		time.Sleep(pollInterval)
+	}
+}
+
+// Returns the state of the job, pending if it could not be queried
+func queryJob(profileName string, client *http.Client, apiURL string, params url.Values) (*jobState, error) {
+	var resp *http.Response
+	var body []byte
+	var err error
+	start := time.Now()
+	defer func() {
+		recordSample(profileName, params, start, resp, body, err, false)
+	}()
+
+	pending := &jobState{Status: jobPending}
+	resp, err = client.Get(fmt.Sprintf("%s?%s", apiURL, params.Encode()))
+	if err != nil {
+		return pending, err
+	}
+	defer resp.Body.Close()
+	body, err = io.ReadAll(resp.Body)
+	if err != nil {
+		return pending, err
+	}
+
+	var data struct {
+		Response struct {
+			JobStatus int `json:"jobstatus"`
+			JobResult struct {
+				ErrorCode int    `json:"errorcode"`
+				ErrorText string `json:"errortext"`
+			} `json:"jobresult"`
+			ErrorCode int    `json:"errorcode"`
+			ErrorText string `json:"errortext"`
+		} `json:"queryasyncjobresultresponse"`
+	}
+	if err = json.Unmarshal(body, &data); err != nil {
+		return pending, err
+	}
+	if data.Response.ErrorCode != 0 {
+		// The job cannot be queried, e.g. it does not exist or belongs to another account
+		return &jobState{Status: jobFailed, ErrorCode: data.Response.ErrorCode, ErrorText: data.Response.ErrorText}, nil
+	}
+	return &jobState{
+		Status:    data.Response.JobStatus,
+		ErrorCode: data.Response.JobResult.ErrorCode,
+		ErrorText: data.Response.JobResult.ErrorText,
+	}, nil
+}
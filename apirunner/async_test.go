@@ -0,0 +1,100 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apirunner
+
+import (
+	"csbench/failure"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Serves queryAsyncJobResult with the responses in order, the last one repeated
+func jobServer(t *testing.T, responses ...string) (*httptest.Server, *int32) {
+	t.Helper()
+	polls := new(int32)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if command := req.URL.Query().Get("command"); command != "queryAsyncJobResult" {
+			t.Errorf("command = %q, want queryAsyncJobResult", command)
+		}
+		poll := int(atomic.AddInt32(polls, 1))
+		if poll > len(responses) {
+			poll = len(responses)
+		}
+		fmt.Fprintf(w, `{"queryasyncjobresultresponse":%s}`, responses[poll-1])
+	}))
+	t.Cleanup(server.Close)
+	return server, polls
+}
+
+func TestWaitForJob(t *testing.T) {
+	const pollInterval = 20 * time.Millisecond
+	pending := `{"jobid":"j1","jobstatus":0}`
+	tests := []struct {
+		name      string
+		responses []string
+		want      *failure.Error
+		polls     int32
+	}{
+		{"done right away", []string{`{"jobid":"j1","jobstatus":1,"jobresult":{}}`}, nil, 1},
+		{"done after polls", []string{pending, pending, `{"jobid":"j1","jobstatus":1,"jobresult":{}}`}, nil, 3},
+		{"failed", []string{pending, `{"jobid":"j1","jobstatus":2,"jobresult":{"errorcode":530,"errortext":"Unable to start the VM"}}`},
+			failure.New("startVirtualMachine", failure.CloudStack, 530, "Unable to start the VM"), 2},
+		{"not found", []string{`{"errorcode":431,"errortext":"Unable to find the job"}`},
+			failure.New("startVirtualMachine", failure.CloudStack, 431, "Unable to find the job"), 1},
+		{"invalid response", []string{`{"jobid":`, `{"jobid":"j1","jobstatus":1,"jobresult":{}}`}, nil, 2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server, polls := jobServer(t, test.responses...)
+			jobParams := func(jobId string) url.Values {
+				return url.Values{"command": {"queryAsyncJobResult"}, "jobid": {jobId}}
+			}
+			jobErr, queueTime := waitForJob("admin", server.Client(), server.URL, "startVirtualMachine", jobParams, "j1", pollInterval, time.Minute)
+			if !reflect.DeepEqual(jobErr, test.want) {
+				t.Errorf("waitForJob() error = %v, want %v", jobErr, test.want)
+			}
+			if *polls != test.polls {
+				t.Errorf("polls = %d, want %d", *polls, test.polls)
+			}
+			// The queue time is measured until the poll that saw the job done
+			if waited := time.Duration(test.polls-1) * pollInterval; queueTime < waited.Seconds() || queueTime > waited.Seconds()+0.5 {
+				t.Errorf("queue time = %.3fs, want about %s", queueTime, waited)
+			}
+		})
+	}
+}
+
+func TestWaitForJobTimeout(t *testing.T) {
+	server, _ := jobServer(t, `{"jobid":"j1","jobstatus":0}`)
+	jobParams := func(jobId string) url.Values {
+		return url.Values{"command": {"queryAsyncJobResult"}, "jobid": {jobId}}
+	}
+	jobErr, queueTime := waitForJob("admin", server.Client(), server.URL, "startVirtualMachine", jobParams, "j1", 10*time.Millisecond, 50*time.Millisecond)
+	if jobErr == nil || jobErr.Category != failure.Timeout {
+		t.Fatalf("waitForJob() error = %v, want a timeout", jobErr)
+	}
+	if queueTime < 0.05 {
+		t.Errorf("queue time = %.3fs, want at least the timeout", queueTime)
+	}
+}
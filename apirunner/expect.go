@@ -0,0 +1,48 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apirunner
+
+import (
+	"csbench/scenario"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+/*
+Checks the statistics of the run against the expectations of the case. The
+expectations that were not met are saved in the summary, to be written to the
+report, and counted in the stats of the runner.
+*/
+func (r *Runner) checkExpectations(testCase *scenario.Case, summary *Summary) {
+	expect := testCase.Expect
+	if expect == nil {
+		return
+	}
+
+	failures := expect.Check(summary.ErrorRate, summary.AvgTime, summary.Percentile95, summary.Percentile99)
+	if len(failures) == 0 {
+		return
+	}
+	summary.Expectations = strings.Join(failures, "; ")
+	log.Warnf("Case %s did not meet the expectations: %s", testCase.Name, summary.Expectations)
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.stats.FailedExpectations++
+}
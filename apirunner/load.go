@@ -0,0 +1,150 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apirunner
+
+import (
+	"csbench/failure"
+	"csbench/loadprofile"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/sourcegraph/conc/pool"
+)
+
+type apiResult struct {
+	// Time taken by the server to answer the call
+	Elapsed float64
+	// Time from when the call should have been sent until the answer was
+	// received. Same as Elapsed unless the calls are sent at a fixed rate.
+	Latency float64
+	Count   float64
+	Success bool
+	// Why the call failed, nil if it succeeded
+	Error *failure.Error
+	// Stage the call was made in, 0 when not running stages
+	Stage int
+	// Whether the call started an async job. Elapsed then includes the time
+	// to submit the job and the time until it was done
+	Async      bool
+	SubmitTime float64
+	QueueTime  float64
+}
+
+// Makes the warm-up calls one after the other and returns the first one, the cold start of the API
+func warmUp(call func() *apiResult, calls int) *apiResult {
+	var first *apiResult
+	for i := 1; i <= calls; i++ {
+		log.Infof("Started with warm-up call %d", i)
+		result := call()
+		if first == nil {
+			first = result
+		}
+	}
+	return first
+}
+
+/*
+Runs the call with concurrency closed loop clients, each of them sending the
+next call as soon as the previous one returns.
+
+If duration is set, the clients keep calling the API until the duration has
+elapsed, otherwise each client makes iterations calls and stops at the first
+failure.
+*/
+func runClients(call func() *apiResult, concurrency int, iterations int, duration time.Duration) []*apiResult {
+	workerPool := pool.NewWithResults[[]*apiResult]().WithMaxGoroutines(concurrency)
+	deadline := time.Now().Add(duration)
+	for c := 1; c <= concurrency; c++ {
+		client := c
+		workerPool.Go(func() []*apiResult {
+			results := make([]*apiResult, 0, iterations)
+			for i := 1; ; i++ {
+				if duration > 0 {
+					if !time.Now().Before(deadline) {
+						break
+					}
+				} else if i > iterations {
+					break
+				}
+				log.Infof("Started with iteration %d on client %d", i, client)
+				result := call()
+				results = append(results, result)
+				if !result.Success && duration == 0 {
+					break
+				}
+			}
+			return results
+		})
+	}
+
+	var results []*apiResult
+	for _, clientResults := range workerPool.Wait() {
+		results = append(results, clientResults...)
+	}
+	return results
+}
+
+/*
+Sends calls at a constant arrival rate (calls/sec), whatever the response times
+are. This is an open model, a slow server does not slow down the senders, so
+the number of calls in flight grows until the server keeps up again.
+
+The run lasts for duration if set, otherwise iterations calls are sent.
+
+The latency of every call is measured from the time it was scheduled to be sent
+rather than from the time it was actually sent. This avoids coordinated
+omission, where a stalled sender hides the slowest responses from the results.
+*/
+func runAtRate(call func() *apiResult, rate float64, iterations int, duration time.Duration) []*apiResult {
+	interval := time.Duration(float64(time.Second) / rate)
+	total := iterations
+	if duration > 0 {
+		total = int(duration.Seconds() * rate)
+	}
+
+	workerPool := pool.NewWithResults[*apiResult]()
+	start := time.Now()
+	for i := 0; i < total; i++ {
+		intended := start.Add(time.Duration(i) * interval)
+		if wait := time.Until(intended); wait > 0 {
+			time.Sleep(wait)
+		}
+		workerPool.Go(func() *apiResult {
+			result := call()
+			result.Latency = time.Since(intended).Seconds()
+			return result
+		})
+	}
+	return workerPool.Wait()
+}
+
+// Calls the API on as many clients as the stages ask for, see loadprofile.Run
+func runStages(call func() *apiResult, stages []loadprofile.Stage) []*apiResult {
+	var lock sync.Mutex
+	var results []*apiResult
+	loadprofile.Run(stages, func(stage int) bool {
+		result := call()
+		result.Stage = stage
+		lock.Lock()
+		results = append(results, result)
+		lock.Unlock()
+		return true
+	})
+	return results
+}
@@ -0,0 +1,163 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apirunner
+
+import (
+	"csbench/loadprofile"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Returns a call succeeding until it was made failAfter times, and tracking
+// the most calls in flight at once
+func countingCall(failAfter int32, delay time.Duration) (call func() *apiResult, calls *int32, peak *int32) {
+	calls, peak = new(int32), new(int32)
+	var running int32
+	call = func() *apiResult {
+		current := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			highest := atomic.LoadInt32(peak)
+			if current <= highest || atomic.CompareAndSwapInt32(peak, highest, current) {
+				break
+			}
+		}
+		n := atomic.AddInt32(calls, 1)
+		time.Sleep(delay)
+		return &apiResult{Elapsed: delay.Seconds(), Latency: delay.Seconds(), Success: failAfter == 0 || n <= failAfter}
+	}
+	return call, calls, peak
+}
+
+func TestRunClients(t *testing.T) {
+	tests := []struct {
+		name        string
+		concurrency int
+		iterations  int
+		failAfter   int32
+		calls       int32
+	}{
+		{"one client", 1, 5, 0, 5},
+		{"concurrent clients", 4, 3, 0, 12},
+		// A client stops at its first failure
+		{"failure", 1, 5, 2, 3},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			call, calls, peak := countingCall(test.failAfter, 20*time.Millisecond)
+			results := runClients(call, test.concurrency, test.iterations, 0)
+			if *calls != test.calls || len(results) != int(test.calls) {
+				t.Errorf("made %d calls with %d results, want %d", *calls, len(results), test.calls)
+			}
+			if *peak != int32(test.concurrency) {
+				t.Errorf("%d calls in flight at once, want %d", *peak, test.concurrency)
+			}
+		})
+	}
+}
+
+func TestRunClientsForDuration(t *testing.T) {
+	// Failures do not stop the clients of a run with a duration
+	call, calls, peak := countingCall(1, 10*time.Millisecond)
+	start := time.Now()
+	results := runClients(call, 2, 1, 200*time.Millisecond)
+	elapsed := time.Since(start)
+	if elapsed < 200*time.Millisecond || elapsed > time.Second {
+		t.Errorf("ran for %s, want about 200ms", elapsed)
+	}
+	if *calls < 10 || len(results) != int(*calls) {
+		t.Errorf("made %d calls with %d results, want at least 10", *calls, len(results))
+	}
+	if *peak != 2 {
+		t.Errorf("%d calls in flight at once, want 2", *peak)
+	}
+}
+
+func TestRunAtRate(t *testing.T) {
+	tests := []struct {
+		name       string
+		rate       float64
+		iterations int
+		duration   time.Duration
+		calls      int32
+	}{
+		{"iterations", 50, 10, 0, 10},
+		{"duration", 50, 1, 400 * time.Millisecond, 20},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Calls slower than the interval overlap instead of delaying the next ones
+			call, calls, peak := countingCall(0, 100*time.Millisecond)
+			start := time.Now()
+			results := runAtRate(call, test.rate, test.iterations, test.duration)
+			elapsed := time.Since(start)
+			if *calls != test.calls || len(results) != int(test.calls) {
+				t.Errorf("made %d calls with %d results, want %d", *calls, len(results), test.calls)
+			}
+			if want := time.Duration(float64(test.calls-1)/test.rate*float64(time.Second)) + 100*time.Millisecond; elapsed < want || elapsed > want+time.Second {
+				t.Errorf("ran for %s, want about %s", elapsed, want)
+			}
+			if *peak < 2 {
+				t.Errorf("%d calls in flight at once, want the calls to overlap", *peak)
+			}
+			for _, result := range results {
+				if result.Latency < result.Elapsed {
+					t.Errorf("latency %.3fs below the time of the call %.3fs", result.Latency, result.Elapsed)
+				}
+			}
+		})
+	}
+}
+
+func TestRunStages(t *testing.T) {
+	stages := []loadprofile.Stage{{Duration: 0, Target: 3}, {Duration: 300 * time.Millisecond, Target: 3}, {Duration: 0, Target: 1}, {Duration: 300 * time.Millisecond, Target: 1}}
+	call, calls, peak := countingCall(0, 10*time.Millisecond)
+	results := runStages(call, stages)
+	if len(results) != int(*calls) || len(results) == 0 {
+		t.Fatalf("made %d calls with %d results", *calls, len(results))
+	}
+	if *peak != 3 {
+		t.Errorf("%d calls in flight at once, want 3", *peak)
+	}
+	// Every result has the stage it was started in
+	perStage := make(map[int]int)
+	for _, result := range results {
+		perStage[result.Stage]++
+	}
+	// The stages without duration are done as soon as they start
+	if perStage[2]+perStage[4] != len(results) || perStage[4] == 0 {
+		t.Errorf("calls per stage %v, want calls in the stages 2 and 4 only", perStage)
+	}
+	if perStage[2] <= perStage[4] {
+		t.Errorf("%d calls with 3 clients, not more than the %d with 1 client", perStage[2], perStage[4])
+	}
+}
+
+func TestWarmUp(t *testing.T) {
+	call, calls, peak := countingCall(0, time.Millisecond)
+	if first := warmUp(call, 3); first == nil || !first.Success {
+		t.Errorf("warmUp() = %v, want the first call", first)
+	}
+	if *calls != 3 || *peak != 1 {
+		t.Errorf("made %d warm-up calls, %d at once, want 3 one after the other", *calls, *peak)
+	}
+	if first := warmUp(call, 0); first != nil {
+		t.Errorf("warmUp() without calls = %v, want nil", first)
+	}
+}
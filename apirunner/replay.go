@@ -0,0 +1,213 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apirunner
+
+import (
+	"csbench/config"
+	"csbench/replay"
+	"csbench/scenario"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/sourcegraph/conc/pool"
+)
+
+// A replayed request and the outcome of its call
+type replayResult struct {
+	profile string
+	command string
+	result  *apiResult
+}
+
+/*
+Sends the recorded requests again, with their original relative timing divided
+by speed, so that a speed of 2 replays an hour of traffic in 30 minutes. Every
+request is sent at its time whether the previous ones are done or not, like
+with a rate, and is signed again as one of the profiles:
+ 1. the profile with the name of the profile of the request, for csbench samples
+ 2. the profile with the API key of the request
+ 3. the profile named admin, or the first profile otherwise
+
+Async commands are timed until their job is done, like in a benchmark. The
+polls of the recorded client are skipped, the job being polled again. Only the
+requests of the read APIs are replayed, unless writes is set.
+
+The statistics of every command of every profile are saved like the ones of a
+benchmark, the Concurrency column having the most calls in flight at once.
+*/
+func (r *Runner) Replay(requests []*replay.Request, profiles []*config.Profile, speed float64, writes bool) ([]*Summary, error) {
+	if len(profiles) == 0 {
+		return nil, fmt.Errorf("no profiles to replay the requests as")
+	}
+	if speed <= 0 {
+		speed = 1
+	}
+	apiURL := r.options.APIURL
+
+	byName := make(map[string]*config.Profile)
+	byKey := make(map[string]*config.Profile)
+	fallback := profiles[0]
+	for _, profile := range profiles {
+		byName[profile.Name] = profile
+		if profile.ApiKey != "" {
+			byKey[profile.ApiKey] = profile
+		}
+		if profile.Name == "admin" && fallback.Name != "admin" {
+			fallback = profile
+		}
+	}
+	profileOf := func(request *replay.Request) *config.Profile {
+		if profile, ok := byName[request.Profile]; ok {
+			return profile
+		}
+		if profile, ok := byKey[request.APIKey]; ok {
+			return profile
+		}
+		return fallback
+	}
+
+	type credentials struct {
+		client       *http.Client
+		authenticate func(params url.Values) url.Values
+	}
+	logins := make(map[string]*credentials)
+	var selected []*replay.Request
+	skipped := 0
+	for _, request := range requests {
+		if !writes && isPostRequest(request.Command) {
+			skipped++
+			continue
+		}
+		profile := profileOf(request)
+		if _, ok := logins[profile.Name]; !ok {
+			client, authenticate, logout, err := authenticateProfile(r.options.HTTPClient, apiURL, profile)
+			if err != nil {
+				return nil, err
+			}
+			defer logout()
+			logins[profile.Name] = &credentials{client: client, authenticate: authenticate}
+		}
+		selected = append(selected, request)
+	}
+	if skipped > 0 {
+		log.Infof("Skipping %d requests of APIs that are not read only, replay the writes to send them", skipped)
+	}
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("no requests to replay")
+	}
+
+	first := selected[0].Time
+	recorded := selected[len(selected)-1].Time.Sub(first)
+	log.Infof("Replaying %d requests recorded over %s at %.2fx speed, for %s", len(selected), recorded.Round(time.Second),
+		speed, time.Duration(float64(recorded)/speed).Round(time.Second))
+
+	var lock sync.Mutex
+	inFlight, peak := 0, 0
+	var maxLag time.Duration
+	workerPool := pool.NewWithResults[*replayResult]()
+	start := time.Now()
+	for _, request := range selected {
+		request := request
+		intended := start.Add(time.Duration(float64(request.Time.Sub(first)) / speed))
+		if wait := time.Until(intended); wait > 0 {
+			time.Sleep(wait)
+		} else if -wait > maxLag {
+			maxLag = -wait
+		}
+		profile := profileOf(request)
+		login := logins[profile.Name]
+		workerPool.Go(func() *replayResult {
+			lock.Lock()
+			inFlight++
+			if inFlight > peak {
+				peak = inFlight
+			}
+			lock.Unlock()
+			defer func() {
+				lock.Lock()
+				inFlight--
+				lock.Unlock()
+			}()
+
+			params := url.Values{}
+			for key, values := range request.Params {
+				params[key] = values
+			}
+			params.Set("command", request.Command)
+			params.Set("response", "json")
+			elapsed, count, jobId, apiErr := r.executeAPI(profile.Name, login.client, login.authenticate(params), isPostRequest(request.Command), false, nil)
+			result := &replayResult{
+				profile: profile.Name,
+				command: request.Command,
+				result:  &apiResult{Elapsed: elapsed, Latency: elapsed, Count: count, Success: apiErr == nil, Error: apiErr},
+			}
+			if jobId == "" {
+				return result
+			}
+
+			jobParams := func(jobId string) url.Values {
+				return login.authenticate(commandParams("queryAsyncJobResult", 0, 0, url.Values{"jobid": {jobId}}))
+			}
+			jobErr, queueTime := waitForJob(profile.Name, login.client, apiURL, request.Command, jobParams, jobId, r.options.JobPollInterval, r.options.JobTimeout)
+			r.updateStats(profile.Name, request.Command, jobErr, elapsed+queueTime)
+			result.result = &apiResult{
+				Elapsed:    elapsed + queueTime,
+				Latency:    elapsed + queueTime,
+				Count:      count,
+				Success:    jobErr == nil,
+				Error:      jobErr,
+				Async:      true,
+				SubmitTime: elapsed,
+				QueueTime:  queueTime,
+			}
+			return result
+		})
+	}
+	results := workerPool.Wait()
+	wallTime := time.Since(start).Seconds()
+	if maxLag > time.Second {
+		log.Warnf("The requests were sent up to %s later than their time, the replay could not keep up with %.2fx speed", maxLag.Round(time.Millisecond), speed)
+	}
+
+	// Summaries by profile and command, in the order of their first request
+	var keys [][2]string
+	grouped := make(map[[2]string][]*apiResult)
+	for _, result := range results {
+		key := [2]string{result.profile, result.command}
+		if _, ok := grouped[key]; !ok {
+			keys = append(keys, key)
+		}
+		grouped[key] = append(grouped[key], result.result)
+	}
+	var summaries []*Summary
+	for _, key := range keys {
+		profileName, command := key[0], key[1]
+		summary := calculateStats(grouped[key], wallTime)
+		summary.Concurrency = peak
+		log.Infof("Replayed %s as %s, count [%d] : Time in seconds [Min - %.3f] [Max - %.3f] [Avg - %.3f] [Median - %.3f] [95th - %.3f] [99th - %.3f] Error rate [%.2f%%]",
+			command, profileName, summary.Calls, summary.MinTime, summary.MaxTime, summary.AvgTime, summary.Median, summary.Percentile95, summary.Percentile99, summary.ErrorRate)
+		r.save(profileName, &scenario.Case{Name: command, Command: command}, 0, 0, url.Values{}, summary, r.processedAPIs[command])
+		r.processedAPIs[command] = true
+		summaries = append(summaries, summary)
+	}
+	return summaries, nil
+}
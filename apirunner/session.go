@@ -0,0 +1,125 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apirunner
+
+import (
+	"csbench/config"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// A session opened with the login API. Calls made with its client send the
+// JSESSIONID cookie, and their parameters the session key.
+type session struct {
+	client     *http.Client
+	sessionKey string
+}
+
+/*
+Logs in with the username and password, the way the UI does. The domain is the
+path of the domain of the user, like / or /ROOT/sub, the root domain if empty.
+The client of the session shares the transport of httpClient.
+*/
+func login(httpClient *http.Client, apiURL string, username string, password string, domain string) (*session, error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{Transport: httpClient.Transport, Timeout: httpClient.Timeout, Jar: jar}
+
+	params := url.Values{}
+	params.Set("command", "login")
+	params.Set("username", username)
+	params.Set("password", password)
+	if domain != "" {
+		params.Set("domain", domain)
+	}
+	params.Set("response", "json")
+
+	resp, err := client.Post(apiURL, "application/x-www-form-urlencoded", strings.NewReader(params.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var data struct {
+		Response struct {
+			SessionKey string `json:"sessionkey"`
+			ErrorCode  int    `json:"errorcode"`
+			ErrorText  string `json:"errortext"`
+		} `json:"loginresponse"`
+	}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, fmt.Errorf("error parsing the login response with status %d: %w", resp.StatusCode, err)
+	}
+	if data.Response.SessionKey == "" {
+		return nil, fmt.Errorf("login of %s failed with error %d: %s", username, data.Response.ErrorCode, data.Response.ErrorText)
+	}
+	return &session{client: client, sessionKey: data.Response.SessionKey}, nil
+}
+
+// Ends the session, so that benchmarks do not leave sessions behind on the management server
+func (s *session) logout(apiURL string) {
+	params := url.Values{}
+	params.Set("command", "logout")
+	params.Set("sessionkey", s.sessionKey)
+	params.Set("response", "json")
+	resp, err := s.client.Post(apiURL, "application/x-www-form-urlencoded", strings.NewReader(params.Encode()))
+	if err != nil {
+		log.Warnf("Failed to log out: %s", err)
+		return
+	}
+	resp.Body.Close()
+}
+
+/*
+Returns the client to call the APIs as the profile with, and the function adding
+the credentials of the profile to the parameters of a call: the signature made
+with its keys, or the session key of its login for the profiles with a username.
+logout closes the session, if any.
+*/
+func authenticateProfile(httpClient *http.Client, apiURL string, profile *config.Profile) (client *http.Client, authenticate func(params url.Values) url.Values, logout func(), err error) {
+	if !profile.UsesSession() {
+		authenticate = func(params url.Values) url.Values {
+			return signParams(profile.ApiKey, profile.SecretKey, profile.SignatureVersion, profile.Expires, params)
+		}
+		return httpClient, authenticate, func() {}, nil
+	}
+
+	s, err := login(httpClient, apiURL, profile.Username, profile.Password, profile.Domain)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to log in as %s: %w", profile.Username, err)
+	}
+	log.Infof("Logged in as %s for the profile %s", profile.Username, profile.Name)
+	authenticate = func(params url.Values) url.Values {
+		params.Set("sessionkey", s.sessionKey)
+		return params
+	}
+	return s.client, authenticate, func() { s.logout(apiURL) }, nil
+}
@@ -0,0 +1,143 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apirunner
+
+import (
+	"csbench/scenario"
+	"encoding/csv"
+	"fmt"
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	log "github.com/sirupsen/logrus"
+)
+
+// A run of a case with one page size, a point of its scaling curve
+type sweepPoint struct {
+	Page     int
+	PageSize int
+	// nil if no calls were made
+	Summary *Summary
+}
+
+/*
+Prints the latency versus page size table of the case and saves it to
+<API>-pagesizes.csv, next to the report of the API. Does nothing unless the
+case was run with at least two page sizes.
+
+TimePerItem is the average time divided by the number of items fetched by a
+call, the smallest page size with a low time per item and an acceptable
+latency is usually a good default for the UI.
+*/
+func (r *Runner) reportSweep(testCase *scenario.Case, curve []*sweepPoint, extraParams url.Values, user string) {
+	sizes := make(map[int]bool)
+	var points []*sweepPoint
+	for _, point := range curve {
+		if point.Summary != nil {
+			sizes[point.PageSize] = true
+			points = append(points, point)
+		}
+	}
+	if len(sizes) < 2 {
+		return
+	}
+
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	title := fmt.Sprintf("Latency versus page size of %s", testCase.Command)
+	if testCase.Name != testCase.Command {
+		title += fmt.Sprintf(" (%s)", testCase.Name)
+	}
+	t.SetTitle(title)
+	t.AppendHeader(table.Row{"Page", "PageSize", "Count", "Avg", "Median", "95th percentile", "99th percentile", "Throughput", "Error rate", "Time per item (ms)"})
+	for _, point := range points {
+		row := sweepRow(point)
+		t.AppendRow(table.Row{row[0], row[1], row[2], row[3], row[4], row[5], row[6], row[7], row[8], row[9]})
+	}
+	t.Render()
+	if r.options.ReportDir == "" {
+		return
+	}
+
+	dbProfile := r.options.DBProfile
+
+	writeHeader := !r.processedSweeps[testCase.Command]
+	fileMode := os.O_WRONLY | os.O_CREATE
+	if writeHeader {
+		fileMode |= os.O_TRUNC
+	} else {
+		fileMode |= os.O_APPEND
+	}
+	r.processedSweeps[testCase.Command] = true
+
+	fileName := filepath.Join(r.options.ReportDir, testCase.Command+"-pagesizes.csv")
+	file, err := os.OpenFile(fileName, fileMode, 0644)
+	if err != nil {
+		log.Errorf("Error opening the file CSV : %s with error %s\n", fileName, err)
+		return
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	if writeHeader {
+		writer.Write([]string{"Page", "PageSize", "Count", "AvgTime", "Median", "95thPercentile", "99thPercentile", "Throughput", "ErrorRate", "TimePerItem",
+			"keyword", "User", "DBprofile", "Params", "Case"})
+	}
+	for _, point := range points {
+		row := sweepRow(point)
+		writer.Write(append(row, extraParams.Get("keyword"), user, strconv.Itoa(dbProfile), formatParams(extraParams, "keyword"), testCase.Name))
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		log.Errorf("Error writing the page size curve for the API %s with error %s\n", testCase.Command, err)
+	}
+	log.Infof("Page size curve saved to %s successfully.", fileName)
+}
+
+func sweepRow(point *sweepPoint) []string {
+	summary := point.Summary
+	pageValue, pageSizeValue := PageColumns(point.Page, point.PageSize)
+
+	// Items fetched by a call: the whole collection for traversals, otherwise
+	// what is left of it on the page
+	items := summary.Count
+	if point.Page != AllPages {
+		items = math.Min(float64(point.PageSize), summary.Count-float64((point.Page-1)*point.PageSize))
+	}
+	timePerItem := "-"
+	if items > 0 {
+		timePerItem = fmt.Sprintf("%.3f", summary.AvgTime*1000/items)
+	}
+
+	return []string{
+		pageValue,
+		pageSizeValue,
+		fmt.Sprintf("%.f", summary.Count),
+		fmt.Sprintf("%.3f", summary.AvgTime),
+		fmt.Sprintf("%.3f", summary.Median),
+		fmt.Sprintf("%.3f", summary.Percentile95),
+		fmt.Sprintf("%.3f", summary.Percentile99),
+		fmt.Sprintf("%.2f", summary.Throughput),
+		fmt.Sprintf("%.2f", summary.ErrorRate),
+		timePerItem,
+	}
+}
@@ -0,0 +1,226 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apirunner
+
+import (
+	"csbench/scenario"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/montanaflynn/stats"
+	log "github.com/sirupsen/logrus"
+)
+
+// Page value of the report rows of a traversal, which fetch the whole collection
+const AllPages = -1
+
+// Page size used to traverse a collection when neither the case nor the configuration set one
+const defaultTraversePageSize = 500
+
+// Latencies of every page of the traversals of a collection
+type pageLatencies struct {
+	lock sync.Mutex
+	// latencies[i] holds the latencies of page i+1
+	latencies []stats.Float64Data
+}
+
+func (p *pageLatencies) add(page int, latency float64) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for len(p.latencies) < page {
+		p.latencies = append(p.latencies, nil)
+	}
+	p.latencies[page-1] = append(p.latencies[page-1], latency)
+}
+
+/*
+Walks every page of the collection, the way the List helpers of the resource
+packages do, until as many items as the count of the first response have been
+fetched. The result has the time taken to fetch the whole collection, the time
+of every page is added to pages. The calls of warm-up traversals are not counted
+in the statistics of the runner.
+*/
+func (r *Runner) traverse(profileName string, client *http.Client, newParams func(page int) url.Values, pageSize int, postRequest bool, pages *pageLatencies, warmup bool, rules *scenario.Validate) *apiResult {
+	result := &apiResult{Success: true}
+	for page := 1; ; page++ {
+		elapsed, count, _, apiErr := r.executeAPI(profileName, client, newParams(page), postRequest, warmup, rules)
+		result.Elapsed += elapsed
+		if apiErr != nil {
+			result.Success = false
+			result.Error = apiErr
+			break
+		}
+		pages.add(page, elapsed)
+		if page == 1 {
+			result.Count = count
+		}
+		if float64(page*pageSize) >= result.Count {
+			break
+		}
+	}
+	result.Latency = result.Elapsed
+	return result
+}
+
+/*
+Benchmarks fetching the whole collection of the API page by page. Each of the
+concurrency clients walks all the pages iterations times, or until duration has
+elapsed. The report has a row with the time taken to fetch the whole collection,
+and <API>-pages.csv has the latency of every page. The statistics of the whole
+collection are returned. The warm-up traversals are made one after the other
+beforehand, and are left out of both. newTraversal is called at the start of
+every traversal for the parameters of its pages.
+*/
+func (r *Runner) executeTraversal(profileName string, client *http.Client, testCase *scenario.Case, newTraversal func() func(page int) url.Values, iterations int, concurrency int, warmup int, pageSize int, extraParams url.Values, reportAppend bool) *Summary {
+	duration := r.options.Duration
+	command := testCase.Command
+	postRequest := isPostRequest(command)
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	pages := &pageLatencies{}
+	call := func() *apiResult {
+		return r.traverse(profileName, client, newTraversal(), pageSize, postRequest, pages, false, testCase.Validate)
+	}
+
+	var coldStart *apiResult
+	if warmup > 0 {
+		log.Infof("Warming up the API %s with %d traversals", command, warmup)
+		coldStart = warmUp(func() *apiResult {
+			return r.traverse(profileName, client, newTraversal(), pageSize, postRequest, &pageLatencies{}, true, testCase.Validate)
+		}, warmup)
+	}
+
+	if duration > 0 {
+		log.Infof("Traversing all the pages of the API %s with pagesize %d for %s with %d concurrent clients", command, pageSize, duration, concurrency)
+	} else {
+		log.Infof("Traversing all the pages of the API %s with pagesize %d %d times with %d concurrent clients", command, pageSize, iterations, concurrency)
+	}
+	start := time.Now()
+	results := runClients(call, concurrency, iterations, duration)
+	wallTime := time.Since(start).Seconds()
+
+	if len(results) == 0 || len(pages.latencies) == 0 {
+		log.Infof("No pages were fetched for the API %s", command)
+		return nil
+	}
+	summary := calculateStats(results, wallTime)
+	summary.Concurrency = concurrency
+	setColdStart(summary, coldStart, results, warmup)
+	r.checkExpectations(testCase, summary)
+
+	slope := latencySlope(pages.latencies)
+	log.Infof("count [%.f] pages [%d] : Time in seconds to fetch all the pages [Min - %.3f] [Max - %.3f] [Avg - %.3f] [95th - %.3f], latency grows by %.2f ms per page\n",
+		summary.Count, len(pages.latencies), summary.MinTime, summary.MaxTime, summary.AvgTime, summary.Percentile95, slope*1000)
+
+	r.save(profileName, testCase, AllPages, pageSize, extraParams, summary, reportAppend)
+	if r.options.ReportDir != "" {
+		r.savePages(pages, pageSize, slope, extraParams, profileName, testCase, reportAppend)
+	}
+	return summary
+}
+
+// Returns the increase of the average page latency per page in seconds, fitted with least squares
+func latencySlope(latencies []stats.Float64Data) float64 {
+	var sumX, sumY, sumXY, sumXX, n float64
+	for i, pageLatencies := range latencies {
+		if len(pageLatencies) == 0 {
+			continue
+		}
+		x := float64(i + 1)
+		y, _ := pageLatencies.Mean()
+		sumX += x
+		sumY += y
+		sumXY += x * y
+		sumXX += x * x
+		n++
+	}
+	denominator := n*sumXX - sumX*sumX
+	if n < 2 || denominator == 0 {
+		return 0
+	}
+	return (n*sumXY - sumX*sumY) / denominator
+}
+
+/*
+Saves the latency of every page of the traversals to <API>-pages.csv, next to the
+report of the API. The GrowthPerPage column has the increase of the average page
+latency per page, in seconds, over the whole collection.
+*/
+func (r *Runner) savePages(pages *pageLatencies, pageSize int, slope float64, extraParams url.Values, user string, testCase *scenario.Case, reportAppend bool) {
+	dbProfile := r.options.DBProfile
+
+	fileMode := os.O_WRONLY | os.O_CREATE
+	if reportAppend {
+		fileMode |= os.O_APPEND
+	} else {
+		fileMode |= os.O_TRUNC
+	}
+
+	fileName := filepath.Join(r.options.ReportDir, testCase.Command+"-pages.csv")
+	file, err := os.OpenFile(fileName, fileMode, 0644)
+	if err != nil {
+		log.Errorf("Error opening the file CSV : %s with error %s\n", fileName, err)
+		return
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	if !reportAppend {
+		writer.Write([]string{"Page", "PageSize", "Count", "MinTime", "MaxTime", "AvgTime", "Median", "95thPercentile", "GrowthPerPage",
+			"keyword", "User", "DBprofile", "Params", "Case"})
+	}
+	for page, latencies := range pages.latencies {
+		if len(latencies) == 0 {
+			continue
+		}
+		min, _ := latencies.Min()
+		max, _ := latencies.Max()
+		avg, _ := latencies.Mean()
+		median, _ := latencies.Median()
+		percentile95, _ := latencies.Percentile(95)
+		writer.Write([]string{
+			strconv.Itoa(page + 1),
+			strconv.Itoa(pageSize),
+			strconv.Itoa(len(latencies)),
+			fmt.Sprintf("%.3f", min),
+			fmt.Sprintf("%.3f", max),
+			fmt.Sprintf("%.3f", avg),
+			fmt.Sprintf("%.3f", median),
+			fmt.Sprintf("%.3f", percentile95),
+			fmt.Sprintf("%.6f", slope),
+			extraParams.Get("keyword"),
+			user,
+			strconv.Itoa(dbProfile),
+			formatParams(extraParams, "keyword"),
+			testCase.Name,
+		})
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		log.Errorf("Error writing the page latencies for the API %s with error %s\n", testCase.Command, err)
+	}
+}
@@ -0,0 +1,375 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package compare
+
+import (
+	"encoding/csv"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+)
+
+// A row of the report of an API, as saved by -benchmark
+type Row struct {
+	API      string
+	Case     string
+	User     string
+	Page     string
+	PageSize string
+	Keyword  string
+	Params   string
+	Stage    string
+	// Number of calls, 0 for reports saved before the Calls column was added
+	Calls     int
+	AvgTime   float64
+	StdDev    float64
+	Median    float64
+	P95       float64
+	P99       float64
+	ErrorRate float64
+	// Whether the report has no Case column, like the reports saved by the first
+	// versions, which have no parameters nor stage either
+	Legacy bool
+}
+
+// Identifies the same run of an API in two result sets
+func (r *Row) key() string {
+	return strings.Join([]string{r.API, r.Case, r.User, r.Page, r.PageSize, r.Keyword, r.Params, r.Stage}, "|")
+}
+
+// Identifies the same run of an API in a legacy report and another result set
+func (r *Row) legacyKey() string {
+	return strings.Join([]string{r.API, r.User, r.Page, r.PageSize, r.Keyword}, "|")
+}
+
+// Reports of other kinds saved next to the reports of the APIs
+var otherReports = []string{"-histogram.csv", "-pages.csv", "-pagesizes.csv"}
+
+/*
+Reads the reports of the APIs in the directory, like results/<host>/<run-id>,
+in the order of their file and rows. The directory can also be a copy of it
+kept as a baseline.
+*/
+func Load(dir string) ([]*Row, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.csv"))
+	if err != nil {
+		return nil, err
+	}
+	var rows []*Row
+	for _, file := range files {
+		other := false
+		for _, suffix := range otherReports {
+			other = other || strings.HasSuffix(file, suffix)
+		}
+		if other {
+			continue
+		}
+		fileRows, err := loadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %w", file, err)
+		}
+		rows = append(rows, fileRows...)
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("no reports found in %s", dir)
+	}
+	return rows, nil
+}
+
+func loadFile(file string) ([]*Row, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	reader := csv.NewReader(f)
+	// Reports saved by older versions have fewer columns
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) < 2 {
+		return nil, nil
+	}
+
+	columns := make(map[string]int)
+	for i, name := range records[0] {
+		columns[name] = i
+	}
+	api := strings.TrimSuffix(filepath.Base(file), ".csv")
+	var rows []*Row
+	for _, record := range records[1:] {
+		value := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return record[i]
+			}
+			return ""
+		}
+		number := func(name string) float64 {
+			v, _ := strconv.ParseFloat(value(name), 64)
+			return v
+		}
+		stage := value("Stage")
+		if stage == "" {
+			stage = "-"
+		}
+		calls, _ := strconv.Atoi(value("Calls"))
+		_, hasCase := columns["Case"]
+		rows = append(rows, &Row{
+			API:       api,
+			Case:      value("Case"),
+			User:      value("User"),
+			Page:      value("Page"),
+			PageSize:  value("PageSize"),
+			Keyword:   value("keyword"),
+			Params:    value("Params"),
+			Stage:     stage,
+			Calls:     calls,
+			AvgTime:   number("AvgTime"),
+			StdDev:    number("StdDev"),
+			Median:    number("Median"),
+			P95:       number("95thPercentile"),
+			P99:       number("99thPercentile"),
+			ErrorRate: number("ErrorRate"),
+			Legacy:    !hasCase,
+		})
+	}
+	return rows, nil
+}
+
+// When a change between the baseline and the current run is a regression
+type Thresholds struct {
+	// Largest increase of the median, 95th or 99th percentile latency, in percent
+	MaxSlowdown float64
+	// Largest increase of the error rate, in percentage points
+	MaxErrorRateIncrease float64
+	// Significance level of the tests, changes with a higher p-value are not regressions
+	Alpha float64
+	// Whether the runs of the baseline missing from the current run, e.g. the
+	// cases of a profile that failed to log in, are not regressions
+	AllowMissing bool
+}
+
+// The change of a run of an API between the baseline and the current run
+type Delta struct {
+	// nil if the run is only in the other result set
+	Baseline *Row
+	Current  *Row
+	// p-values of the change of the average latency and of the error rate, NaN
+	// if they cannot be tested, e.g. reports without the number of calls
+	LatencyPValue   float64
+	ErrorRatePValue float64
+	// Thresholds exceeded by significant changes, empty if none
+	Regressions []string
+}
+
+/*
+Matches the runs of the APIs of the two result sets, by API, case, user, page,
+page size, parameters and stage, and checks their changes against the
+thresholds. The APIs of legacy reports in the baseline are matched by API,
+user, page, page size and keyword only. When a run is in a result set several
+times, its last row is used. Runs of the baseline missing from the current run
+are regressions, unless the thresholds allow them.
+
+A slower latency or a higher error rate is a regression when it exceeds its
+threshold and its change is significant. The latency is tested with Welch's
+t-test of the average latencies, the error rate with a z-test. Changes that
+cannot be tested are judged by the thresholds alone. The average latency is
+compared instead of the percentiles when the baseline has none of them.
+*/
+func Compare(baseline []*Row, current []*Row, thresholds Thresholds) []*Delta {
+	legacy := make(map[string]bool)
+	for _, row := range baseline {
+		legacy[row.API] = legacy[row.API] || row.Legacy
+	}
+	key := func(row *Row) string {
+		if legacy[row.API] {
+			return row.legacyKey()
+		}
+		return row.key()
+	}
+
+	baselineRows := make(map[string]*Row)
+	for _, row := range baseline {
+		baselineRows[key(row)] = row
+	}
+	currentRows := make(map[string]*Row)
+	var keys []string
+	for _, row := range current {
+		if _, ok := currentRows[key(row)]; !ok {
+			keys = append(keys, key(row))
+		}
+		currentRows[key(row)] = row
+	}
+	for _, row := range baseline {
+		if _, ok := currentRows[key(row)]; !ok {
+			currentRows[key(row)] = nil
+			keys = append(keys, key(row))
+		}
+	}
+
+	var deltas []*Delta
+	for _, key := range keys {
+		delta := &Delta{Baseline: baselineRows[key], Current: currentRows[key], LatencyPValue: math.NaN(), ErrorRatePValue: math.NaN()}
+		if delta.Baseline != nil && delta.Current != nil {
+			delta.check(thresholds)
+		}
+		if delta.Current == nil && !thresholds.AllowMissing {
+			delta.Regressions = append(delta.Regressions, "missing from the current run")
+		}
+		deltas = append(deltas, delta)
+	}
+	return deltas
+}
+
+func (d *Delta) check(thresholds Thresholds) {
+	base, current := d.Baseline, d.Current
+	d.LatencyPValue = welchTest(base.AvgTime, base.StdDev, base.Calls, current.AvgTime, current.StdDev, current.Calls)
+	d.ErrorRatePValue = proportionTest(base.ErrorRate*float64(base.Calls)/100, base.Calls, current.ErrorRate*float64(current.Calls)/100, current.Calls)
+
+	significant := func(pValue float64) bool {
+		return math.IsNaN(pValue) || pValue < thresholds.Alpha
+	}
+	if significant(d.LatencyPValue) {
+		type measure struct {
+			name          string
+			base, current float64
+		}
+		latencies := []measure{
+			{"median", base.Median, current.Median},
+			{"95th percentile", base.P95, current.P95},
+			{"99th percentile", base.P99, current.P99},
+		}
+		// Reports saved before the percentiles were added only have the average
+		if base.Median == 0 && base.P95 == 0 && base.P99 == 0 {
+			latencies = []measure{{"average", base.AvgTime, current.AvgTime}}
+		}
+		for _, latency := range latencies {
+			if change := percentChange(latency.base, latency.current); change > thresholds.MaxSlowdown {
+				d.Regressions = append(d.Regressions, fmt.Sprintf("%s %+.1f%%", latency.name, change))
+			}
+		}
+	}
+	if significant(d.ErrorRatePValue) && current.ErrorRate-base.ErrorRate > thresholds.MaxErrorRateIncrease {
+		d.Regressions = append(d.Regressions, fmt.Sprintf("error rate %+.2f points", current.ErrorRate-base.ErrorRate))
+	}
+}
+
+// Returns the change from base to current in percent, 0 if base is 0
+func percentChange(base float64, current float64) float64 {
+	if base == 0 {
+		return 0
+	}
+	return (current - base) * 100 / base
+}
+
+// Returns the number of regressions of the deltas
+func Regressions(deltas []*Delta) int {
+	count := 0
+	for _, delta := range deltas {
+		if len(delta.Regressions) > 0 {
+			count++
+		}
+	}
+	return count
+}
+
+// Returns the number of runs of the baseline missing from the current run
+func Missing(deltas []*Delta) int {
+	count := 0
+	for _, delta := range deltas {
+		if delta.Current == nil {
+			count++
+		}
+	}
+	return count
+}
+
+// Prints the deltas as a table, in the format of the reports of -create (csv, tsv or table)
+func Render(deltas []*Delta, format string) {
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.SetTitle("Baseline versus current run")
+	t.AppendHeader(table.Row{"API", "Case", "User", "Page", "PageSize", "Params", "Stage", "Median", "95th percentile", "99th percentile", "Error rate", "p-value", "Result"})
+	for _, delta := range deltas {
+		row := delta.Current
+		if row == nil {
+			row = delta.Baseline
+		}
+		params := strings.TrimSpace(strings.Join([]string{row.Keyword, row.Params}, " "))
+		t.AppendRow(table.Row{row.API, row.Case, row.User, row.Page, row.PageSize, params, row.Stage,
+			delta.latencyCell(func(r *Row) float64 { return r.Median }),
+			delta.latencyCell(func(r *Row) float64 { return r.P95 }),
+			delta.latencyCell(func(r *Row) float64 { return r.P99 }),
+			delta.errorRateCell(), formatPValue(delta.LatencyPValue), delta.result()})
+	}
+	switch format {
+	case "csv":
+		t.RenderCSV()
+	case "tsv":
+		t.RenderTSV()
+	default:
+		t.Render()
+	}
+}
+
+func (d *Delta) latencyCell(value func(*Row) float64) string {
+	switch {
+	case d.Baseline == nil:
+		return fmt.Sprintf("%.3f", value(d.Current))
+	case d.Current == nil:
+		return fmt.Sprintf("%.3f", value(d.Baseline))
+	}
+	base, current := value(d.Baseline), value(d.Current)
+	return fmt.Sprintf("%.3f -> %.3f (%+.1f%%)", base, current, percentChange(base, current))
+}
+
+func (d *Delta) errorRateCell() string {
+	switch {
+	case d.Baseline == nil:
+		return fmt.Sprintf("%.2f", d.Current.ErrorRate)
+	case d.Current == nil:
+		return fmt.Sprintf("%.2f", d.Baseline.ErrorRate)
+	}
+	return fmt.Sprintf("%.2f -> %.2f", d.Baseline.ErrorRate, d.Current.ErrorRate)
+}
+
+func formatPValue(pValue float64) string {
+	if math.IsNaN(pValue) {
+		return "-"
+	}
+	return fmt.Sprintf("%.4f", pValue)
+}
+
+func (d *Delta) result() string {
+	switch {
+	case d.Baseline == nil:
+		return "new"
+	case len(d.Regressions) > 0:
+		return "REGRESSION: " + strings.Join(d.Regressions, ", ")
+	case d.Current == nil:
+		return "missing"
+	}
+	return "ok"
+}
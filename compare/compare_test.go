@@ -0,0 +1,203 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package compare
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeReport(t *testing.T, dir string, name string, lines ...string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	writeReport(t, dir, "listVirtualMachines.csv",
+		"Count,AvgTime,Median,95thPercentile,99thPercentile,StdDev,ErrorRate,Calls,Page,PageSize,keyword,User,Params,Case,Stage",
+		"10,0.100,0.090,0.200,0.300,0.010,1.50,40,1,50,web,admin,state=Running,running vms,",
+		"10,0.110,0.100,0.210,0.310,0.020,0.00,40,-,-,,user1,,running vms,2")
+	writeReport(t, dir, "listVirtualMachines-histogram.csv", "Bucket,Count", "0.1,3")
+	writeReport(t, dir, "listVirtualMachines-pages.csv", "Page,Count", "1,3")
+	// Reports saved before the Calls, StdDev and Stage columns were added
+	writeReport(t, dir, "listZones.csv",
+		"Count,MinTime,MaxTime,AvgTime,Page,PageSize,keyword,User,DBprofile",
+		"1,0.010,0.030,0.020,-,-,,admin,0")
+
+	rows, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*Row{
+		{API: "listVirtualMachines", Case: "running vms", User: "admin", Page: "1", PageSize: "50", Keyword: "web", Params: "state=Running", Stage: "-",
+			Calls: 40, AvgTime: 0.1, StdDev: 0.01, Median: 0.09, P95: 0.2, P99: 0.3, ErrorRate: 1.5},
+		{API: "listVirtualMachines", Case: "running vms", User: "user1", Page: "-", PageSize: "-", Stage: "2",
+			Calls: 40, AvgTime: 0.11, StdDev: 0.02, Median: 0.1, P95: 0.21, P99: 0.31},
+		{API: "listZones", User: "admin", Page: "-", PageSize: "-", Stage: "-", AvgTime: 0.02, Legacy: true},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		for i := range rows {
+			t.Logf("row %d: %+v", i, *rows[i])
+		}
+		t.Errorf("Load() returned %d rows, not the expected ones", len(rows))
+	}
+}
+
+func TestLoadWithoutReports(t *testing.T) {
+	dir := t.TempDir()
+	writeReport(t, dir, "listZones-histogram.csv", "Bucket,Count", "0.1,3")
+	if _, err := Load(dir); err == nil {
+		t.Error("Load() of a directory without reports succeeded")
+	}
+}
+
+func row(api string, user string, calls int, avg float64, stdDev float64, median float64, errorRate float64) *Row {
+	return &Row{API: api, User: user, Page: "-", PageSize: "-", Stage: "-", Calls: calls, AvgTime: avg, StdDev: stdDev,
+		Median: median, P95: median * 2, P99: median * 3, ErrorRate: errorRate}
+}
+
+func TestCompare(t *testing.T) {
+	thresholds := Thresholds{MaxSlowdown: 15, MaxErrorRateIncrease: 1, Alpha: 0.05}
+	tests := []struct {
+		name       string
+		baseline   *Row
+		current    *Row
+		thresholds Thresholds
+		want       []string
+		result     string
+	}{
+		{"same latency", row("listZones", "admin", 100, 0.1, 0.01, 0.1, 0),
+			row("listZones", "admin", 100, 0.1, 0.01, 0.1, 0), thresholds, nil, "ok"},
+		{"significantly slower", row("listZones", "admin", 100, 0.1, 0.01, 0.1, 0),
+			row("listZones", "admin", 100, 0.2, 0.01, 0.2, 0), thresholds,
+			[]string{"median +100.0%", "95th percentile +100.0%", "99th percentile +100.0%"}, "REGRESSION: median +100.0%, 95th percentile +100.0%, 99th percentile +100.0%"},
+		{"slower within the threshold", row("listZones", "admin", 100, 0.1, 0.01, 0.1, 0),
+			row("listZones", "admin", 100, 0.11, 0.01, 0.11, 0), thresholds, nil, "ok"},
+		{"slower but not significant", row("listZones", "admin", 3, 0.1, 0.5, 0.1, 0),
+			row("listZones", "admin", 3, 0.2, 0.5, 0.2, 0), thresholds, nil, "ok"},
+		{"slower without the number of calls", row("listZones", "admin", 0, 0.1, 0, 0.1, 0),
+			row("listZones", "admin", 0, 0.2, 0, 0.2, 0), thresholds,
+			[]string{"median +100.0%", "95th percentile +100.0%", "99th percentile +100.0%"}, "REGRESSION: median +100.0%, 95th percentile +100.0%, 99th percentile +100.0%"},
+		{"more errors", row("listZones", "admin", 1000, 0.1, 0.01, 0.1, 0),
+			row("listZones", "admin", 1000, 0.1, 0.01, 0.1, 5), thresholds, []string{"error rate +5.00 points"}, "REGRESSION: error rate +5.00 points"},
+		{"more errors but not significant", row("listZones", "admin", 10, 0.1, 0.01, 0.1, 0),
+			row("listZones", "admin", 10, 0.1, 0.01, 0.1, 10), thresholds, nil, "ok"},
+		{"new", nil, row("listZones", "admin", 100, 0.1, 0.01, 0.1, 0), thresholds, nil, "new"},
+		{"missing", row("listZones", "admin", 100, 0.1, 0.01, 0.1, 0), nil, thresholds,
+			[]string{"missing from the current run"}, "REGRESSION: missing from the current run"},
+		{"missing allowed", row("listZones", "admin", 100, 0.1, 0.01, 0.1, 0), nil,
+			Thresholds{MaxSlowdown: 15, MaxErrorRateIncrease: 1, Alpha: 0.05, AllowMissing: true}, nil, "missing"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var baseline, current []*Row
+			if test.baseline != nil {
+				baseline = append(baseline, test.baseline)
+			}
+			if test.current != nil {
+				current = append(current, test.current)
+			}
+			deltas := Compare(baseline, current, test.thresholds)
+			if len(deltas) != 1 {
+				t.Fatalf("Compare() returned %d deltas, want 1", len(deltas))
+			}
+			if !reflect.DeepEqual(deltas[0].Regressions, test.want) {
+				t.Errorf("regressions = %q, want %q", deltas[0].Regressions, test.want)
+			}
+			if result := deltas[0].result(); result != test.result {
+				t.Errorf("result() = %q, want %q", result, test.result)
+			}
+		})
+	}
+}
+
+func TestCompareMatchesRows(t *testing.T) {
+	thresholds := Thresholds{MaxSlowdown: 15, MaxErrorRateIncrease: 1, Alpha: 0.05}
+	baseline := []*Row{
+		row("listZones", "admin", 100, 0.1, 0.01, 0.1, 0),
+		row("listZones", "user1", 100, 0.1, 0.01, 0.1, 0),
+		row("listHosts", "admin", 100, 0.1, 0.01, 0.1, 0),
+	}
+	current := []*Row{
+		row("listZones", "user1", 100, 0.3, 0.01, 0.3, 0),
+		row("listZones", "admin", 100, 0.5, 0.01, 0.5, 0),
+		// The last row of a run is compared
+		row("listZones", "admin", 100, 0.1, 0.01, 0.1, 0),
+		row("listVolumes", "admin", 100, 0.1, 0.01, 0.1, 0),
+	}
+	deltas := Compare(baseline, current, thresholds)
+	var results []string
+	for _, delta := range deltas {
+		name := delta.Baseline
+		if name == nil {
+			name = delta.Current
+		}
+		results = append(results, name.API+" "+name.User+" "+strings.SplitN(delta.result(), ":", 2)[0])
+	}
+	want := []string{"listZones user1 REGRESSION", "listZones admin ok", "listVolumes admin new", "listHosts admin REGRESSION"}
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("Compare() = %q, want %q", results, want)
+	}
+	if regressions := Regressions(deltas); regressions != 2 {
+		t.Errorf("Regressions() = %d, want 2", regressions)
+	}
+	if missing := Missing(deltas); missing != 1 {
+		t.Errorf("Missing() = %d, want 1", missing)
+	}
+}
+
+func TestCompareLegacyBaseline(t *testing.T) {
+	baselineDir, currentDir := t.TempDir(), t.TempDir()
+	writeReport(t, baselineDir, "listVirtualMachines.csv",
+		"Count,MinTime,MaxTime,AvgTime,Page,PageSize,keyword,User,DBprofile",
+		"7,0.05,0.20,0.10,-,-,,admin,0",
+		"7,0.05,0.20,0.10,1,50,web,admin,0",
+		"7,0.05,0.20,0.10,-,-,,user1,0")
+	writeReport(t, currentDir, "listVirtualMachines.csv",
+		"Count,AvgTime,Median,95thPercentile,99thPercentile,StdDev,ErrorRate,Calls,Page,PageSize,keyword,User,Params,Case,Stage",
+		"7,0.105,0.100,0.200,0.300,0.010,0.00,40,-,-,,admin,state=Running,running vms,",
+		"7,0.200,0.190,0.300,0.400,0.010,0.00,40,1,50,web,admin,state=Running,running vms,")
+	baseline, err := Load(baselineDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, err := Load(currentDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deltas := Compare(baseline, current, Thresholds{MaxSlowdown: 15, MaxErrorRateIncrease: 1, Alpha: 0.05, AllowMissing: true})
+	var results []string
+	for _, delta := range deltas {
+		name := delta.Baseline
+		if name == nil {
+			name = delta.Current
+		}
+		results = append(results, name.User+" "+name.Page+" "+delta.result())
+	}
+	want := []string{"admin - ok", "admin 1 REGRESSION: average +100.0%", "user1 - missing"}
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("Compare() = %q, want %q", results, want)
+	}
+}
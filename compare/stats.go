@@ -0,0 +1,136 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package compare
+
+import "math"
+
+/*
+Returns the two-sided p-value of Welch's t-test of the difference of two means,
+from the mean, standard deviation and size of each sample. NaN if a sample has
+fewer than two values.
+*/
+func welchTest(mean1, stdDev1 float64, n1 int, mean2, stdDev2 float64, n2 int) float64 {
+	if n1 < 2 || n2 < 2 {
+		return math.NaN()
+	}
+	variance1 := stdDev1 * stdDev1 / float64(n1)
+	variance2 := stdDev2 * stdDev2 / float64(n2)
+	if variance1+variance2 == 0 {
+		if mean1 == mean2 {
+			return 1
+		}
+		return 0
+	}
+	t := (mean2 - mean1) / math.Sqrt(variance1+variance2)
+	// Welch–Satterthwaite degrees of freedom
+	df := (variance1 + variance2) * (variance1 + variance2) /
+		(variance1*variance1/float64(n1-1) + variance2*variance2/float64(n2-1))
+	return regularizedBeta(df/(df+t*t), df/2, 0.5)
+}
+
+/*
+Returns the two-sided p-value of the z-test of the difference of two
+proportions, like the error rates of two runs, from the number of failures and
+the size of each sample. NaN if a sample is empty.
+*/
+func proportionTest(failures1 float64, n1 int, failures2 float64, n2 int) float64 {
+	if n1 == 0 || n2 == 0 {
+		return math.NaN()
+	}
+	p1 := failures1 / float64(n1)
+	p2 := failures2 / float64(n2)
+	pooled := (failures1 + failures2) / float64(n1+n2)
+	standardError := math.Sqrt(pooled * (1 - pooled) * (1/float64(n1) + 1/float64(n2)))
+	if standardError == 0 {
+		if p1 == p2 {
+			return 1
+		}
+		return 0
+	}
+	z := math.Abs(p2-p1) / standardError
+	return math.Erfc(z / math.Sqrt2)
+}
+
+// Returns the regularized incomplete beta function I_x(a, b)
+func regularizedBeta(x, a, b float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+	if x >= 1 {
+		return 1
+	}
+	lgammaAB, _ := math.Lgamma(a + b)
+	lgammaA, _ := math.Lgamma(a)
+	lgammaB, _ := math.Lgamma(b)
+	front := math.Exp(lgammaAB - lgammaA - lgammaB + a*math.Log(x) + b*math.Log(1-x))
+	// The continued fraction converges quickly for x below (a+1)/(a+b+2), use
+	// the symmetry of the function otherwise
+	if x < (a+1)/(a+b+2) {
+		return front * betaFraction(x, a, b) / a
+	}
+	return 1 - front*betaFraction(1-x, b, a)/b
+}
+
+// Evaluates the continued fraction of the incomplete beta function with the modified Lentz method
+func betaFraction(x, a, b float64) float64 {
+	const (
+		maxIterations = 300
+		epsilon       = 1e-14
+		tiny          = 1e-300
+	)
+	c := 1.0
+	d := 1 - (a+b)*x/(a+1)
+	if math.Abs(d) < tiny {
+		d = tiny
+	}
+	d = 1 / d
+	result := d
+	for m := 1; m <= maxIterations; m++ {
+		m2 := float64(2 * m)
+		fm := float64(m)
+		// Even step
+		numerator := fm * (b - fm) * x / ((a + m2 - 1) * (a + m2))
+		d = 1 + numerator*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1 + numerator/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		result *= d * c
+		// Odd step
+		numerator = -(a + fm) * (a + b + fm) * x / ((a + m2) * (a + m2 + 1))
+		d = 1 + numerator*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1 + numerator/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		delta := d * c
+		result *= delta
+		if math.Abs(delta-1) < epsilon {
+			break
+		}
+	}
+	return result
+}
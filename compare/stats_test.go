@@ -0,0 +1,111 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package compare
+
+import (
+	"math"
+	"testing"
+)
+
+func TestWelchTest(t *testing.T) {
+	tests := []struct {
+		name           string
+		mean1, stdDev1 float64
+		n1             int
+		mean2, stdDev2 float64
+		n2             int
+		want           float64
+	}{
+		// Two samples of two values with the same variance have 2 degrees of
+		// freedom, for which the p-value is 1 - |t|/sqrt(2+t^2)
+		{"t of 1", 0, 1, 2, 1, 1, 2, 1 - 1/math.Sqrt(3)},
+		{"t of 2", 0, 1, 2, 2, 1, 2, 1 - 2/math.Sqrt(6)},
+		{"slower and faster are the same", 2, 1, 2, 0, 1, 2, 1 - 2/math.Sqrt(6)},
+		{"same means", 0.5, 0.1, 100, 0.5, 0.2, 50, 1},
+		{"no variance and same means", 1, 0, 10, 1, 0, 10, 1},
+		{"no variance and other means", 1, 0, 10, 2, 0, 10, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := welchTest(test.mean1, test.stdDev1, test.n1, test.mean2, test.stdDev2, test.n2)
+			if math.Abs(got-test.want) > 1e-9 {
+				t.Errorf("welchTest() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestWelchTestTooFewCalls(t *testing.T) {
+	for _, n := range [][2]int{{0, 10}, {1, 10}, {10, 1}} {
+		if got := welchTest(1, 0.1, n[0], 2, 0.1, n[1]); !math.IsNaN(got) {
+			t.Errorf("welchTest() with %d and %d calls = %v, want NaN", n[0], n[1], got)
+		}
+	}
+}
+
+func TestProportionTest(t *testing.T) {
+	tests := []struct {
+		name      string
+		failures1 float64
+		n1        int
+		failures2 float64
+		n2        int
+		want      float64
+	}{
+		{"10% versus 20%", 10, 100, 20, 100, 0.04767038065616144},
+		{"20% versus 10%", 20, 100, 10, 100, 0.04767038065616144},
+		{"same rates", 5, 100, 10, 200, 1},
+		{"no failures", 0, 100, 0, 100, 1},
+		{"all failed", 100, 100, 100, 100, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := proportionTest(test.failures1, test.n1, test.failures2, test.n2)
+			if math.Abs(got-test.want) > 1e-9 {
+				t.Errorf("proportionTest() = %v, want %v", got, test.want)
+			}
+		})
+	}
+	if got := proportionTest(0, 0, 1, 10); !math.IsNaN(got) {
+		t.Errorf("proportionTest() without calls = %v, want NaN", got)
+	}
+}
+
+func TestRegularizedBeta(t *testing.T) {
+	tests := []struct {
+		x, a, b float64
+		want    float64
+	}{
+		{0, 2, 3, 0},
+		{1, 2, 3, 1},
+		// I_x(1, 1) = x
+		{0.3, 1, 1, 0.3},
+		// I_x(a, 1) = x^a
+		{0.5, 3, 1, 0.125},
+		{0.9, 2.5, 1, math.Pow(0.9, 2.5)},
+		// I_x(1, b) = 1 - (1-x)^b
+		{0.2, 1, 4, 1 - math.Pow(0.8, 4)},
+		{0.95, 1, 0.5, 1 - math.Sqrt(0.05)},
+	}
+	for _, test := range tests {
+		got := regularizedBeta(test.x, test.a, test.b)
+		if math.Abs(got-test.want) > 1e-9 {
+			t.Errorf("regularizedBeta(%v, %v, %v) = %v, want %v", test.x, test.a, test.b, got, test.want)
+		}
+	}
+}
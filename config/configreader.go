@@ -19,10 +19,14 @@ package config
 
 import (
 	"bufio"
+	"csbench/loadprofile"
 	"fmt"
+	"net/http"
 	"net/url"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -33,12 +37,52 @@ type Profile struct {
 	SecretKey        string
 	Expires          int `default:"600"`
 	SignatureVersion int `default:"3"`
+	// Credentials of the login API, used instead of the API key and secret key
+	// when they are set, the way the UI authenticates
+	Username string
+	Password string
+	Domain   string
+}
+
+// Returns whether the profile logs in with its username and password rather than signing its calls
+func (p *Profile) UsesSession() bool {
+	return p.Username != ""
 }
 
 var URL = "http://localhost:8080/client/api/"
 var Iterations = 1
 var Page = 0
 var PageSize = 0
+var PageSizes []int
+var Concurrency = 1
+var Warmup = 0
+var Duration time.Duration = 0
+var Rate = 0.0
+var Stages []loadprofile.Stage
+var Scenario = "listCommands.txt"
+var ResultsDir = "results"
+var Traverse = false
+var JobPollInterval = time.Second
+var JobTimeout = time.Hour
+var Timeout time.Duration = 0
+var KeepAlive = true
+var MaxIdleConns = 0
+var VerifySSL = false // Unverified when the key is absent, like before it was added
+var CACert = ""
+var ClientCert = ""
+var ClientKey = ""
+var Proxy = ""
+var Headers = http.Header{}
+var InfluxURL = ""
+var InfluxToken = ""
+var GraphiteAddress = ""
+var StatsDAddress = ""
+var SinkInterval = 10 * time.Second
+var SinkTags = map[string]string{}
+var MaxErrorRate = -1.0
+var MaxAvgTime = 0.0
+var MaxP95Time = 0.0
+var MaxP99Time = 0.0
 var Host = ""
 var ZoneId = ""
 var NetworkOfferingId = ""
@@ -93,6 +137,12 @@ func ReadProfiles(filePath string) (map[int]*Profile, error) {
 					profiles[i].ApiKey = value
 				case "secretkey":
 					profiles[i].SecretKey = value
+				case "username":
+					profiles[i].Username = value
+				case "password":
+					profiles[i].Password = value
+				case "domain":
+					profiles[i].Domain = value
 				case "url":
 					URL = value
 				case "iterations":
@@ -113,6 +163,179 @@ func ReadProfiles(filePath string) (map[int]*Profile, error) {
 					if err == nil {
 						PageSize = pagesize
 					}
+				case "pagesizes":
+					if value == "" {
+						continue
+					}
+					pageSizes, err := parseIntList(value)
+					if err == nil {
+						PageSizes = pageSizes
+					} else {
+						log.Warnf("Invalid pagesizes %s in the configuration, ignoring them: %s", value, err)
+					}
+				case "concurrency":
+					var concurrency int
+					_, err := fmt.Sscanf(value, "%d", &concurrency)
+					if err == nil && concurrency > 0 {
+						Concurrency = concurrency
+					}
+				case "warmup":
+					var warmup int
+					_, err := fmt.Sscanf(value, "%d", &warmup)
+					if err == nil && warmup >= 0 {
+						Warmup = warmup
+					}
+				case "duration":
+					duration, err := parseDuration(value)
+					if err == nil {
+						Duration = duration
+					} else {
+						log.Warnf("Invalid duration %s in the configuration, ignoring it", value)
+					}
+				case "rate":
+					var rate float64
+					_, err := fmt.Sscanf(value, "%g", &rate)
+					if err == nil && rate >= 0 {
+						Rate = rate
+					}
+				case "stages":
+					if value == "" {
+						continue
+					}
+					stages, err := loadprofile.ParseStages(value)
+					if err == nil {
+						Stages = stages
+					} else {
+						log.Warnf("Invalid stages %s in the configuration, ignoring them: %s", value, err)
+					}
+				case "timeout":
+					if value == "" {
+						continue
+					}
+					timeout, err := parseDuration(value)
+					if err == nil {
+						Timeout = timeout
+					} else {
+						log.Warnf("Invalid timeout %s in the configuration, ignoring it", value)
+					}
+				case "keepalive":
+					var keepAlive bool
+					_, err := fmt.Sscanf(value, "%t", &keepAlive)
+					if err == nil {
+						KeepAlive = keepAlive
+					}
+				case "maxidleconns":
+					var maxIdleConns int
+					_, err := fmt.Sscanf(value, "%d", &maxIdleConns)
+					if err == nil {
+						MaxIdleConns = maxIdleConns
+					}
+				case "verifyssl":
+					var verifySSL bool
+					_, err := fmt.Sscanf(value, "%t", &verifySSL)
+					if err == nil {
+						VerifySSL = verifySSL
+					}
+				case "cacert":
+					CACert = value
+				case "clientcert":
+					ClientCert = value
+				case "clientkey":
+					ClientKey = value
+				case "proxy":
+					Proxy = value
+				case "header":
+					// Can be repeated, one header per line like "header = X-Name: value"
+					name, headerValue, found := strings.Cut(value, ":")
+					if found && strings.TrimSpace(name) != "" {
+						Headers.Add(strings.TrimSpace(name), strings.TrimSpace(headerValue))
+					} else {
+						log.Warnf("Invalid header %s in the configuration, expected Name: value", value)
+					}
+				case "influxurl":
+					InfluxURL = value
+				case "influxtoken":
+					InfluxToken = value
+				case "graphiteaddress":
+					GraphiteAddress = value
+				case "statsdaddress":
+					StatsDAddress = value
+				case "sinkinterval":
+					if value == "" {
+						continue
+					}
+					interval, err := parseDuration(value)
+					if err == nil {
+						SinkInterval = interval
+					} else {
+						log.Warnf("Invalid sinkinterval %s in the configuration, ignoring it", value)
+					}
+				case "sinktag":
+					// Can be repeated, one tag per line like "sinktag = run=nightly-42"
+					name, tagValue, found := strings.Cut(value, "=")
+					if found && strings.TrimSpace(name) != "" {
+						SinkTags[strings.TrimSpace(name)] = strings.TrimSpace(tagValue)
+					} else {
+						log.Warnf("Invalid sinktag %s in the configuration, expected name=value", value)
+					}
+				case "maxerrorrate":
+					if value == "" {
+						continue
+					}
+					var maxErrorRate float64
+					_, err := fmt.Sscanf(value, "%g", &maxErrorRate)
+					if err == nil && maxErrorRate >= 0 {
+						MaxErrorRate = maxErrorRate
+					} else {
+						log.Warnf("Invalid maxerrorrate %s in the configuration, ignoring it", value)
+					}
+				case "maxavgtime", "maxp95time", "maxp99time":
+					var maxTime float64
+					_, err := fmt.Sscanf(value, "%g", &maxTime)
+					if err == nil && maxTime >= 0 {
+						switch strings.ToLower(key) {
+						case "maxavgtime":
+							MaxAvgTime = maxTime
+						case "maxp95time":
+							MaxP95Time = maxTime
+						case "maxp99time":
+							MaxP99Time = maxTime
+						}
+					}
+				case "jobpollinterval":
+					if value == "" {
+						continue
+					}
+					interval, err := parseDuration(value)
+					if err == nil && interval > 0 {
+						JobPollInterval = interval
+					} else {
+						log.Warnf("Invalid jobpollinterval %s in the configuration, ignoring it", value)
+					}
+				case "jobtimeout":
+					if value == "" {
+						continue
+					}
+					timeout, err := parseDuration(value)
+					if err == nil && timeout > 0 {
+						JobTimeout = timeout
+					} else {
+						log.Warnf("Invalid jobtimeout %s in the configuration, ignoring it", value)
+					}
+				case "traverse":
+					var traverse bool
+					_, err := fmt.Sscanf(value, "%t", &traverse)
+					if err == nil {
+						Traverse = traverse
+					}
+				case "scenario":
+					if value != "" {
+						Scenario = value
+					}
+				case "resultsdir":
+					if value != "" {
+						ResultsDir = value
+					}
 				case "expires":
 					var expires int
 					_, err := fmt.Sscanf(value, "%d", &expires)
@@ -216,12 +439,45 @@ func ReadProfiles(filePath string) (map[int]*Profile, error) {
 	return profiles, nil
 }
 
+// parseDuration accepts either a number of seconds or a Go duration string like 5m or 1h30m
+func parseDuration(value string) (time.Duration, error) {
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second, nil
+	}
+	return time.ParseDuration(value)
+}
+
+// parseIntList parses a comma separated list of positive numbers like 10,50,100
+func parseIntList(value string) ([]int, error) {
+	var numbers []int
+	for _, field := range strings.Split(value, ",") {
+		number, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil {
+			return nil, err
+		}
+		if number <= 0 {
+			return nil, fmt.Errorf("%d is not a positive number", number)
+		}
+		numbers = append(numbers, number)
+	}
+	return numbers, nil
+}
+
 func validateConfig(profiles map[int]*Profile) bool {
 
 	result := true
 	for i, profile := range profiles {
+		if profile.UsesSession() {
+			if profile.Password == "" {
+				message := "Please check Password of the profile. It should not be empty when Username is set"
+				fmt.Printf("Skipping profile [%s] : %s\n", profile.Name, message)
+				delete(profiles, i)
+				result = false
+			}
+			continue
+		}
 		if profile.ApiKey == "" || profile.SecretKey == "" {
-			message := "Please check ApiKey, SecretKey of the profile. They should not be empty"
+			message := "Please check ApiKey, SecretKey of the profile. They should not be empty, unless Username and Password are set"
 			fmt.Printf("Skipping profile [%s] : %s\n", profile.Name, message)
 			delete(profiles, i)
 			result = false
@@ -18,17 +18,36 @@
 package main
 
 import (
+	"csbench/compare"
 	"csbench/domain"
+	"csbench/failure"
+	"csbench/htmlreport"
+	"csbench/httpclient"
+	"csbench/loadprofile"
+	"csbench/lookup"
+	"csbench/metadata"
+	"csbench/metrics"
 	"csbench/network"
+	"csbench/replay"
+	"csbench/report"
+	"csbench/results"
+	"csbench/samples"
+	"csbench/scenario"
 	"csbench/vm"
 	"csbench/volume"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
 	"math"
 	"math/rand"
+	"net/http"
 	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"csbench/apirunner"
@@ -44,11 +63,23 @@ import (
 
 var (
 	profiles = make(map[int]*config.Profile)
+	// Shared by all the calls to the management server
+	httpClient *http.Client
+	// Settings of the run and environment it runs against, nil when only comparing reports
+	runMetadata *metadata.Metadata
+	// Directory the results of the run are saved to, results/<host>/<run-id>
+	runDir string
 )
 
 type Result struct {
 	Success  bool
 	Duration float64
+	// Stage the task was run in, 0 when not running stages
+	Stage int
+	// Why the task failed, nil if it succeeded
+	Error *failure.Error
+	// When the task finished
+	Time time.Time
 }
 
 func init() {
@@ -76,31 +107,63 @@ func logConfigurationDetails(profiles map[int]*config.Profile) {
 	iterations := config.Iterations
 	page := config.Page
 	pagesize := config.PageSize
+	concurrency := config.Concurrency
+	duration := config.Duration
+	rate := config.Rate
+	stages := config.Stages
 	host := config.Host
 
 	userProfileNames := make([]string, 0, len(profiles))
 	for _, profile := range profiles {
-		userProfileNames = append(userProfileNames, profile.Name)
+		if profile.UsesSession() {
+			userProfileNames = append(userProfileNames, profile.Name+" (login)")
+		} else {
+			userProfileNames = append(userProfileNames, profile.Name)
+		}
 	}
 
 	fmt.Printf("\n\n\033[1;34mBenchmarking the CloudStack environment [%s] with the following configuration\033[0m\n\n", apiURL)
 	fmt.Printf("Management server : %s\n", host)
 	fmt.Printf("Roles : %s\n", strings.Join(userProfileNames, ","))
-	fmt.Printf("Iterations : %d\n", iterations)
+	if len(stages) > 0 {
+		fmt.Printf("Stages : %s\n", loadprofile.Format(stages))
+	} else if rate > 0 {
+		fmt.Printf("Rate : %.2f calls/sec\n", rate)
+	}
+	if len(stages) > 0 {
+		fmt.Printf("Duration : %s\n", loadprofile.TotalDuration(stages))
+	} else if duration > 0 {
+		fmt.Printf("Duration : %s\n", duration)
+	} else {
+		fmt.Printf("Iterations : %d\n", iterations)
+	}
 	fmt.Printf("Page : %d\n", page)
-	fmt.Printf("PageSize : %d\n\n", pagesize)
+	if len(config.PageSizes) > 0 {
+		fmt.Printf("PageSizes : %s\n", strings.Trim(fmt.Sprint(config.PageSizes), "[]"))
+	} else {
+		fmt.Printf("PageSize : %d\n", pagesize)
+	}
+	fmt.Printf("Concurrency : %d\n\n", concurrency)
 
 	log.Infof("Found %d profiles in the configuration: ", len(profiles))
 	log.Infof("Management server : %s", host)
 }
 
-func logReport() {
+func logReport(runner *apirunner.Runner) {
+	runStats := runner.Stats()
 	fmt.Printf("\n\n\nLog file : csmetrics.log\n")
-	fmt.Printf("Reports directory per API : report/%s/\n", config.Host)
-	fmt.Printf("Number of APIs : %d\n", apirunner.APIscount)
-	fmt.Printf("Successful APIs : %d\n", apirunner.SuccessAPIs)
-	fmt.Printf("Failed APIs : %d\n", apirunner.FailedAPIs)
-	fmt.Printf("Time in seconds per API: %.2f (avg)\n", apirunner.TotalTime/float64(apirunner.APIscount))
+	fmt.Printf("Reports directory per API : %s/\n", runDir)
+	fmt.Printf("Number of APIs : %d\n", runStats.Calls)
+	fmt.Printf("Successful APIs : %d\n", runStats.Succeeded)
+	fmt.Printf("Failed APIs : %d\n", runStats.Failed)
+	fmt.Printf("Time in seconds per API: %.2f (avg)\n", runStats.TotalTime/float64(runStats.Calls))
+	if runStats.FailedExpectations > 0 {
+		fmt.Printf("Runs that did not meet the expectations of their case : %d\n", runStats.FailedExpectations)
+	}
+	if runner.Errors().Total() > 0 {
+		fmt.Println()
+		newErrorsTable(runner.Errors().Top(topErrors)).Render()
+	}
 	fmt.Printf("\n\n\033[1;34m--------------------------------------------------------------------------------\033[0m\n" +
 		"                            Done with benchmarking\n" +
 		"\033[1;34m--------------------------------------------------------------------------------\033[0m\n\n")
@@ -124,6 +187,21 @@ func getSamples(results []*Result) (stats.Float64Data, stats.Float64Data, stats.
 	return allExecutionsSample, successfulExecutionSample, failedExecutionSample
 }
 
+// Splits the results by the stage they were run in. The results of stage N are at index N-1.
+func getStageResults(results []*Result) [][]*Result {
+	var stageResults [][]*Result
+	for _, result := range results {
+		if result.Stage == 0 {
+			continue
+		}
+		for len(stageResults) < result.Stage {
+			stageResults = append(stageResults, nil)
+		}
+		stageResults[result.Stage-1] = append(stageResults[result.Stage-1], result)
+	}
+	return stageResults
+}
+
 func getRowFromSample(key string, sample stats.Float64Data) table.Row {
 	min, _ := sample.Min()
 	min = math.Round(min*1000) / 1000
@@ -149,13 +227,21 @@ This function will generate a report with the following details:
  2. Number of successful executions
  3. Number of failed exections
  4. Different statistics like min, max, avg, median, 90th percentile, 95th percentile, 99th percentile for above 3
+ 5. The most frequent errors of the failed executions, by operation, category and code
 
 Output format:
  1. CSV
  2. TSV
  3. Table
+ 4. Markdown
+ 5. JSON and JUnit XML, with the statistics of every type of task checked
+    against the expectations of the configuration file
 */
-func generateReport(results map[string][]*Result, format string, outputFile string) {
+func generateReport(mode string, results map[string][]*Result, format string, outputFile string) {
+	if format == "json" || format == "junit" {
+		writeDocument(report.Tasks(mode, config.Host, taskResults(results), taskExpectations()), format, outputFile)
+		return
+	}
 	fmt.Println("Generating report")
 
 	t := table.NewWriter()
@@ -170,6 +256,30 @@ func generateReport(results map[string][]*Result, format string, outputFile stri
 			t.AppendRow(getRowFromSample(fmt.Sprintf("%s - Successful", key), successfulExecutionSample))
 			t.AppendRow(getRowFromSample(fmt.Sprintf("%s - Failed", key), failedExecutionSample))
 		}
+
+		for i, stageResults := range getStageResults(result) {
+			if len(stageResults) == 0 {
+				continue
+			}
+			allStageSample, _, failedStageSample := getSamples(stageResults)
+			t.AppendRow(getRowFromSample(fmt.Sprintf("%s - Stage %d - All", key, i+1), allStageSample))
+			if failedStageSample.Len() != 0 {
+				t.AppendRow(getRowFromSample(fmt.Sprintf("%s - Stage %d - Failed", key, i+1), failedStageSample))
+			}
+		}
+	}
+
+	errors := failure.NewCounter()
+	for _, result := range results {
+		for _, r := range result {
+			if !r.Success {
+				errors.Add(r.Error)
+			}
+		}
+	}
+	var errorsTable table.Writer
+	if errors.Total() > 0 {
+		errorsTable = newErrorsTable(errors.Top(topErrors))
 	}
 
 	if outputFile != "" {
@@ -179,17 +289,157 @@ func generateReport(results map[string][]*Result, format string, outputFile stri
 		}
 		defer f.Close()
 		t.SetOutputMirror(f)
+		if errorsTable != nil {
+			errorsTable.SetOutputMirror(f)
+		}
+	}
+	for _, writer := range []table.Writer{t, errorsTable} {
+		if writer == nil {
+			continue
+		}
+		switch format {
+		case "csv":
+			writer.RenderCSV()
+		case "tsv":
+			writer.RenderTSV()
+		case "table":
+			writer.Render()
+		case "markdown":
+			writer.RenderMarkdown()
+		}
+	}
+}
+
+// Writes the JSON or JUnit XML report to outputFile, or to stdout if not set
+func writeDocument(document *report.Document, format string, outputFile string) {
+	out := os.Stdout
+	if outputFile != "" {
+		f, err := os.Create(outputFile)
+		if err != nil {
+			log.Error("Error creating file: ", err)
+			return
+		}
+		defer f.Close()
+		out = f
+	}
+	if runMetadata != nil {
+		runMetadata.Finish()
+		document.Metadata = runMetadata
+	}
+	var err error
+	if format == "junit" {
+		err = document.WriteJUnit(out)
+	} else {
+		err = document.WriteJSON(out)
+	}
+	if err != nil {
+		log.Errorf("Error writing the %s report: %s", format, err)
+	}
+}
+
+// Returns the expectations of the configuration file that every type of task is checked against
+func taskExpectations() *scenario.Expect {
+	expect := &scenario.Expect{
+		MaxAvgTime: config.MaxAvgTime,
+		MaxP95Time: config.MaxP95Time,
+		MaxP99Time: config.MaxP99Time,
+	}
+	if config.MaxErrorRate >= 0 {
+		expect.MaxErrorRate = &config.MaxErrorRate
 	}
+	return expect
+}
+
+/*
+Saves the summary of every API of the benchmark or replay to outputFile, in the
+format. JSON and JUnit XML reports check every API against the expectations of
+its case.
+*/
+func saveBenchmarkReport(mode string, runner *apirunner.Runner, format string, outputFile string) {
+	document := report.Benchmark(mode, config.Host, runner.Summaries(), runner.Errors().Top(0))
+	if format == "json" || format == "junit" {
+		writeDocument(document, format, outputFile)
+		fmt.Printf("Summary report : %s\n", outputFile)
+		return
+	}
+
+	f, err := os.Create(outputFile)
+	if err != nil {
+		log.Error("Error creating file: ", err)
+		return
+	}
+	defer f.Close()
+	t := newBenchmarkTable(document)
+	t.SetOutputMirror(f)
+	renderTable(t, format)
+	fmt.Printf("Summary report : %s\n", outputFile)
+}
+
+// Returns the table of the summary of every API of the benchmark report
+func newBenchmarkTable(document *report.Document) table.Writer {
+	t := table.NewWriter()
+	t.AppendHeader(table.Row{"Profile", "API", "Case", "Page", "PageSize", "Stage", "Calls", "Failed", "Min", "Max", "Avg", "Median",
+		"90th percentile", "95th percentile", "99th percentile", "Cold start", "Throughput", "Error rate", "Expectations"})
+	for _, api := range document.APIs {
+		page, pageSize := apirunner.PageColumns(api.Page, api.PageSize)
+		stage := "-"
+		if api.Stage > 0 {
+			stage = strconv.Itoa(api.Stage)
+		}
+		expectations := "-"
+		if len(api.Expectations) > 0 {
+			expectations = strings.Join(api.Expectations, "; ")
+		}
+		t.AppendRow(table.Row{api.Profile, api.Command, api.Case, page, pageSize, stage, api.Calls, api.Failed, api.Min, api.Max, api.Avg, api.Median,
+			api.P90, api.P95, api.P99, apirunner.ColdStartColumn(api.ColdStart), math.Round(api.Throughput*100) / 100, math.Round(api.ErrorRate*100) / 100, expectations})
+	}
+	return t
+}
+
+// Returns the table of the statistics of every type of task of a create, teardown or VM action report
+func newTasksTable(document *report.Document) table.Writer {
+	t := table.NewWriter()
+	t.AppendHeader(table.Row{"Type", "Count", "Failed", "Min", "Max", "Avg", "Median", "90th percentile", "95th percentile", "99th percentile", "Error rate", "Expectations"})
+	for _, task := range document.Tasks {
+		expectations := "-"
+		if len(task.Expectations) > 0 {
+			expectations = strings.Join(task.Expectations, "; ")
+		}
+		t.AppendRow(table.Row{task.Type, task.Count, task.Failed, task.Min, task.Max, task.Avg, task.Median, task.P90, task.P95, task.P99,
+			math.Round(task.ErrorRate*100) / 100, expectations})
+	}
+	return t
+}
+
+// Renders the table in the format, as a table for the formats that are not tabular
+func renderTable(t table.Writer, format string) {
 	switch format {
 	case "csv":
 		t.RenderCSV()
 	case "tsv":
 		t.RenderTSV()
-	case "table":
+	case "markdown":
+		t.RenderMarkdown()
+	default:
 		t.Render()
 	}
 }
 
+// Number of kinds of errors listed in the reports
+const topErrors = 10
+
+func newErrorsTable(counts []*failure.Count) table.Writer {
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.SetTitle("Top errors")
+	t.AppendHeader(table.Row{"Operation", "Category", "Code", "Message", "Count"})
+	for _, count := range counts {
+		err := count.Error
+		t.AppendRow(table.Row{err.Operation, err.Category, err.Code, err.Message, count.Count})
+	}
+	return t
+}
+
 func main() {
 	dbprofile := flag.Int("dbprofile", 0, "DB profile number")
 	create := flag.Bool("create", false, "Create resources. Specify at least one of the following options:\n\t"+
@@ -199,6 +449,22 @@ func main() {
 		"-vm - Deploy VMs in all networks in the subdomains\n\t"+
 		"-volume - Create and attach Volumes to VMs")
 	benchmark := flag.Bool("benchmark", false, "Benchmark list APIs")
+	compareFlag := flag.Bool("compare", false, "Compare the reports of a run with the ones of a baseline, and exit with status 1 if an API got slower or failed more.\n\t"+
+		"-baseline - Run id or directory of the reports of the baseline\n\t"+
+		"-current - Run id or directory of the reports of the run, the last benchmark run against the host by default")
+	baselineDir := flag.String("baseline", "", "Run id, or directory of the reports, of the baseline. Valid only for compare")
+	currentDir := flag.String("current", "", "Run id, or directory of the reports, of the run to compare, the last benchmark run against the host by default. Valid only for compare")
+	replayFile := flag.String("replay", "", "Path to a recorded log to send the requests of again, with their original timing and signed with the profiles.\n\t"+
+		"A csbench samples file, the apilog.log of a management server or an access log")
+	speed := flag.Float64("speed", 1, "Speed of the replay, 2 sends the requests twice as fast as they were recorded. Valid only for replay")
+	replayWrites := flag.Bool("replaywrites", false, "Replay the requests of all the APIs, not only of the read only ones. Valid only for replay")
+	listRuns := flag.Bool("runs", false, "List the runs saved to the results directory")
+	showRun := flag.String("showrun", "", "Show the settings and results of the run with the id, or a unique prefix of it")
+	deleteRun := flag.String("deleterun", "", "Delete the results of the run with the id, or a unique prefix of it")
+	maxSlowdown := flag.Float64("maxslowdown", 15, "Largest increase in percent of the median, 95th or 99th percentile latency of an API. Valid only for compare")
+	maxErrorIncrease := flag.Float64("maxerrorincrease", 1, "Largest increase in percentage points of the error rate of an API. Valid only for compare")
+	alpha := flag.Float64("alpha", 0.05, "Significance level of the changes. Valid only for compare")
+	allowMissing := flag.Bool("allowmissing", false, "Do not fail when APIs of the baseline are missing from the current run. Valid only for compare")
 	domainFlag := flag.Bool("domain", false, "Works with -create & -teardown\n\t"+
 		"-create - Create subdomains and accounts\n\t"+
 		"-teardown - Delete all subdomains and accounts")
@@ -224,8 +490,13 @@ func main() {
 		"-vm - Delete all VMs in the subdomains\n\t"+
 		"-volume - Delete all volumes in the subdomains")
 	workers := flag.Int("workers", 10, "Number of workers to use while creating resources")
-	format := flag.String("format", "table", "Format of the report (csv, tsv, table). Valid only for create")
-	outputFile := flag.String("output", "", "Path to output file. Valid only for create")
+	format := flag.String("format", "table", "Format of the report (csv, tsv, table, markdown, json, junit)")
+	outputFile := flag.String("output", "", "Path to output file. For benchmark, the summary of every API is saved to it")
+	metricsAddress := flag.String("metrics", "", "Address to serve live Prometheus metrics on while running, like :9100. Metrics are served on /metrics")
+	htmlFile := flag.String("html", "", "Path to save a self-contained HTML report of the run to, with its charts")
+	samplesFile := flag.String("samples", "", "Path to a JSON Lines file to save every API call to, with its parameters, status and duration")
+	scenarioFile := flag.String("scenario", "", "Path to the scenario to benchmark, a YAML or JSON file, or a text file like listCommands.txt.\n\t"+
+		"Overrides the scenario of the config file. Valid only for benchmark")
 	configFile := flag.String("config", "config/config", "Path to config file")
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Options:\n")
@@ -233,8 +504,16 @@ func main() {
 	}
 	flag.Parse()
 
-	if !(*create || *benchmark || *tearDown || *vmAction != "") {
-		log.Fatal("Please provide one of the following options: -create, -benchmark, -vmaction, -teardown")
+	if !(*create || *benchmark || *tearDown || *vmAction != "" || *replayFile != "" || *compareFlag || *listRuns || *showRun != "" || *deleteRun != "") {
+		log.Fatal("Please provide one of the following options: -create, -benchmark, -vmaction, -teardown, -replay, -compare, -runs, -showrun, -deleterun")
+	}
+
+	if *speed <= 0 {
+		log.Fatal("Invalid replay speed. Please provide a positive number.")
+	}
+
+	if *compareFlag && *baselineDir == "" {
+		log.Fatal("Please provide the directory of the reports of the baseline with -baseline")
 	}
 
 	if *create && *tearDown && *vmAction == "" {
@@ -254,10 +533,10 @@ func main() {
 	}
 
 	switch *format {
-	case "csv", "tsv", "table":
+	case "csv", "tsv", "table", "markdown", "json", "junit":
 		// valid format, continue
 	default:
-		log.Fatal("Invalid format. Please provide one of the following: csv, tsv, table")
+		log.Fatal("Invalid format. Please provide one of the following: csv, tsv, table, markdown, json, junit")
 	}
 
 	if *dbprofile < 0 {
@@ -265,44 +544,539 @@ func main() {
 	}
 
 	profiles = readConfigurations(*configFile)
+	httpClient = newHTTPClient()
+
+	if *metricsAddress != "" {
+		if err := metrics.Serve(*metricsAddress); err != nil {
+			log.Fatalf("Failed to serve the metrics on %s: %s", *metricsAddress, err)
+		}
+	}
+
+	if *samplesFile != "" {
+		if err := samples.Open(*samplesFile); err != nil {
+			log.Fatalf("Failed to open samples file %s: %s", *samplesFile, err)
+		}
+		defer samples.Close()
+	}
 	apiURL := config.URL
-	iterations := config.Iterations
-	page := config.Page
-	pagesize := config.PageSize
+
+	var modes []string
+	for mode, enabled := range map[string]bool{"create": *create, "vmaction": *vmAction != "", "teardown": *tearDown, "benchmark": *benchmark, "replay": *replayFile != ""} {
+		if enabled {
+			modes = append(modes, mode)
+		}
+	}
+	if len(modes) > 0 {
+		sort.Strings(modes)
+		runMetadata = newRunMetadata(modes, *configFile, *dbprofile)
+		runDir = results.RunDir(config.ResultsDir, config.Host, runMetadata.Run)
+		openSinks(*dbprofile, runMetadata.Run)
+		defer metrics.CloseSinks()
+	}
+	htmlReport := htmlreport.New(fmt.Sprintf("csbench report for %s", config.Host))
 
 	if *create {
 		results := createResources(domainFlag, limitsFlag, networkFlag, vmFlag, volumeFlag, workers)
-		generateReport(results, *format, *outputFile)
+		generateReport("create", results, *format, *outputFile)
+		saveResults(report.Tasks("create", config.Host, taskResults(results), taskExpectations()))
+		htmlReport.AddSections(htmlreport.Tasks("Create", taskResults(results))...)
 	}
 
 	if *vmAction != "" {
 		results := executeVMAction(vmAction, workers)
-		generateReport(results, *format, *outputFile)
+		generateReport("vmaction", results, *format, *outputFile)
+		saveResults(report.Tasks("vmaction", config.Host, taskResults(results), taskExpectations()))
+		htmlReport.AddSections(htmlreport.Tasks("VM action "+*vmAction, taskResults(results))...)
 	}
 
 	if *tearDown {
 		results := tearDownEnv(domainFlag, networkFlag, vmFlag, volumeFlag, workers)
-		generateReport(results, *format, *outputFile)
+		generateReport("teardown", results, *format, *outputFile)
+		saveResults(report.Tasks("teardown", config.Host, taskResults(results), taskExpectations()))
+		htmlReport.AddSections(htmlreport.Tasks("Teardown", taskResults(results))...)
 	}
 
 	if *benchmark {
-		log.Infof("\nStarted benchmarking the CloudStack environment [%s]", apiURL)
+		scenarioPath := config.Scenario
+		if *scenarioFile != "" {
+			scenarioPath = *scenarioFile
+		}
+		benchmarkScenario, err := scenario.Load(scenarioPath)
+		if err != nil {
+			log.Fatalf("Error reading the scenario %s: %s", scenarioPath, err)
+		}
+
+		var resolver *lookup.Resolver
+		if usesPlaceholders(benchmarkScenario) {
+			resolver = newResolver()
+		}
+
+		log.Infof("\nStarted benchmarking the CloudStack environment [%s] with the scenario %s", apiURL, benchmarkScenario.Name)
 
 		logConfigurationDetails(profiles)
 
+		runner := apirunner.New(newRunnerOptions(benchmarkScenario, resolver, *dbprofile))
 		for i, profile := range profiles {
 			userProfileName := profile.Name
 			log.Infof("Using profile %d.%s for benchmarking", i, userProfileName)
 			fmt.Printf("\n\033[1;34m============================================================\033[0m\n")
 			fmt.Printf("                    Profile: [%s]\n", userProfileName)
 			fmt.Printf("\033[1;34m============================================================\033[0m\n")
-			apirunner.RunAPIs(userProfileName, apiURL, profile.ApiKey, profile.SecretKey, profile.Expires, profile.SignatureVersion, iterations, page, pagesize, *dbprofile)
+			cases := benchmarkScenario.CasesFor(userProfileName)
+			if len(cases) == 0 {
+				log.Infof("No cases of the scenario %s are run by the profile %s", benchmarkScenario.Name, userProfileName)
+				continue
+			}
+			if _, err := runner.Run(profile); err != nil {
+				log.Errorf("Skipping the profile %s: %s", userProfileName, err)
+			}
 		}
-		logReport()
+		logReport(runner)
+		if *outputFile != "" {
+			saveBenchmarkReport("benchmark", runner, *format, *outputFile)
+		}
+		saveResults(report.Benchmark("benchmark", config.Host, runner.Summaries(), runner.Errors().Top(0)))
+		htmlReport.AddSections(htmlreport.Benchmark(runner.Summaries(), runner.Timeline(), runner.Errors().Top(0))...)
 
 		log.Infof("Done with benchmarking the CloudStack environment [%s]", apiURL)
 	}
 
+	if *replayFile != "" {
+		requests, err := replay.Load(*replayFile)
+		if err != nil {
+			log.Fatalf("Error reading the requests to replay: %s", err)
+		}
+		log.Infof("\nStarted replaying %s against the CloudStack environment [%s]", *replayFile, apiURL)
+
+		runner := apirunner.New(newRunnerOptions(nil, nil, *dbprofile))
+		if _, err := runner.Replay(requests, sortedProfiles(), *speed, *replayWrites); err != nil {
+			log.Errorf("Failed to replay %s: %s", *replayFile, err)
+		}
+		logReport(runner)
+		if *outputFile != "" {
+			saveBenchmarkReport("replay", runner, *format, *outputFile)
+		}
+		saveResults(report.Benchmark("replay", config.Host, runner.Summaries(), runner.Errors().Top(0)))
+		htmlReport.AddSections(htmlreport.Benchmark(runner.Summaries(), runner.Timeline(), runner.Errors().Top(0))...)
+
+		log.Infof("Done with replaying %s against the CloudStack environment [%s]", *replayFile, apiURL)
+	}
+
+	if runMetadata != nil {
+		runMetadata.Finish()
+		if _, err := results.Save(config.ResultsDir, config.Host, runMetadata); err != nil {
+			log.Errorf("Failed to save the manifest of the run: %s", err)
+		} else {
+			fmt.Printf("Results of the run %s : %s\n", runMetadata.Run, runDir)
+		}
+	}
+
+	if *htmlFile != "" && len(htmlReport.Sections) > 0 {
+		addReportMetadata(htmlReport)
+		if err := htmlReport.Write(*htmlFile); err != nil {
+			log.Errorf("Failed to save the HTML report to %s: %s", *htmlFile, err)
+		} else {
+			fmt.Printf("HTML report : %s\n", *htmlFile)
+		}
+	}
+
+	if *listRuns {
+		printRuns(*format)
+	}
+
+	if *showRun != "" {
+		printRun(*showRun, *format)
+	}
+
+	if *deleteRun != "" {
+		entry, err := results.Delete(config.ResultsDir, *deleteRun)
+		if err != nil {
+			log.Fatalf("Failed to delete the run %s: %s", *deleteRun, err)
+		}
+		fmt.Printf("Deleted the run %s of %s\n", entry.Run, entry.Host)
+	}
+
+	if *compareFlag {
+		baseline := resolveRunDir(*baselineDir)
+		current := ""
+		if *currentDir != "" {
+			current = resolveRunDir(*currentDir)
+		} else {
+			latest, err := results.Latest(config.ResultsDir, config.Host, "benchmark")
+			if err != nil {
+				log.Fatalf("Failed to read the runs of %s: %s", config.ResultsDir, err)
+			}
+			if latest == nil {
+				log.Fatalf("No benchmark run against %s in %s, please provide the run to compare with -current", config.Host, config.ResultsDir)
+			}
+			current = latest.Dir(config.ResultsDir)
+		}
+		thresholds := compare.Thresholds{MaxSlowdown: *maxSlowdown, MaxErrorRateIncrease: *maxErrorIncrease, Alpha: *alpha, AllowMissing: *allowMissing}
+		if !compareReports(baseline, current, thresholds, *format) {
+			metrics.CloseSinks()
+			samples.Close()
+			os.Exit(1)
+		}
+	}
+
+}
+
+// Returns the settings of the benchmark from the config file
+func newRunnerOptions(benchmarkScenario *scenario.Scenario, resolver *lookup.Resolver, dbProfile int) apirunner.Options {
+	page := config.Page
+	pagesizes := []int{config.PageSize}
+	if len(config.PageSizes) > 0 {
+		// Sweeping page sizes needs a page to fetch
+		pagesizes = config.PageSizes
+		if page == 0 {
+			page = 1
+		}
+	}
+	return apirunner.Options{
+		APIURL:          config.URL,
+		HTTPClient:      httpClient,
+		Scenario:        benchmarkScenario,
+		Resolver:        resolver,
+		Iterations:      config.Iterations,
+		Concurrency:     config.Concurrency,
+		Warmup:          config.Warmup,
+		Duration:        config.Duration,
+		Rate:            config.Rate,
+		Stages:          config.Stages,
+		Page:            page,
+		PageSizes:       pagesizes,
+		Traverse:        config.Traverse,
+		DBProfile:       dbProfile,
+		JobPollInterval: config.JobPollInterval,
+		JobTimeout:      config.JobTimeout,
+		ReportDir:       runDir,
+		Run:             runMetadata.Run,
+	}
+}
+
+// Returns the profiles of the configuration in the order of their numbers
+func sortedProfiles() []*config.Profile {
+	ids := make([]int, 0, len(profiles))
+	for id := range profiles {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	sorted := make([]*config.Profile, 0, len(ids))
+	for _, id := range ids {
+		sorted = append(sorted, profiles[id])
+	}
+	return sorted
+}
+
+// Adds the settings of the run to the top of the HTML report
+func addReportMetadata(report *htmlreport.Report) {
+	profileNames := make([]string, 0, len(profiles))
+	for _, profile := range profiles {
+		profileNames = append(profileNames, profile.Name)
+	}
+	sort.Strings(profileNames)
+
+	report.AddField("Management server", config.URL)
+	if runMetadata.CloudStackVersion != "" {
+		report.AddField("CloudStack version", runMetadata.CloudStackVersion)
+	}
+	for _, server := range runMetadata.ManagementServers {
+		report.AddField("Management server "+server.Name, fmt.Sprintf("%s %s %s", server.IPAddress, server.Version, server.State))
+	}
+	if len(runMetadata.Inventory) > 0 {
+		report.AddField("Inventory", runMetadata.InventorySummary())
+	}
+	report.AddField("Run", runMetadata.Run)
+	report.AddField("Started", runMetadata.Started.Format(time.RFC1123))
+	report.AddField("Finished", runMetadata.Finished.Format(time.RFC1123))
+	report.AddField("Duration", runMetadata.Finished.Sub(runMetadata.Started).Round(time.Second).String())
+	report.AddField("csbench version", runMetadata.CsbenchVersion)
+	report.AddField("Command", strings.Join(runMetadata.CommandLine, " "))
+	report.AddField("Config file", fmt.Sprintf("%s (%s)", runMetadata.ConfigFile, runMetadata.ConfigHash))
+	report.AddField("Profiles", strings.Join(profileNames, ", "))
+	report.AddField("DB profile", strconv.Itoa(runMetadata.DBProfile))
+	if len(config.Stages) > 0 {
+		report.AddField("Stages", loadprofile.Format(config.Stages))
+	} else {
+		report.AddField("Iterations", strconv.Itoa(config.Iterations))
+		report.AddField("Concurrency", strconv.Itoa(config.Concurrency))
+		if config.Duration > 0 {
+			report.AddField("Duration per API", config.Duration.String())
+		}
+		if config.Rate > 0 {
+			report.AddField("Rate", fmt.Sprintf("%.2f calls/sec", config.Rate))
+		}
+	}
+}
+
+/*
+Returns the metadata of the run, with the version and size of the environment
+collected as the admin profile. Its calls go through a client of their own, so
+they are not counted in the results or the metrics.
+*/
+func newRunMetadata(modes []string, configFile string, dbProfile int) *metadata.Metadata {
+	runMetadata := metadata.New(modes, os.Args, configFile, config.URL, dbProfile)
+	for _, profile := range profiles {
+		if profile.Name == "admin" && !profile.UsesSession() {
+			timeout := httpClient.Timeout
+			if timeout == 0 {
+				timeout = 60 * time.Second
+			}
+			client := &http.Client{Transport: httpClient.Transport, Timeout: timeout}
+			runMetadata.Collect(cloudstack.NewAsyncClient(config.URL, profile.ApiKey, profile.SecretKey, false, cloudstack.WithHTTPClient(client)))
+			return runMetadata
+		}
+	}
+	log.Warn("No admin profile with an API key, the metadata of the run will not have the version and size of the environment")
+	return runMetadata
+}
+
+// Converts the results of create, teardown or VM action tasks for the HTML, JSON and JUnit reports
+func taskResults(results map[string][]*Result) map[string][]*report.TaskResult {
+	tasks := make(map[string][]*report.TaskResult, len(results))
+	for key, result := range results {
+		for _, r := range result {
+			tasks[key] = append(tasks[key], &report.TaskResult{Success: r.Success, Duration: r.Duration, Stage: r.Stage, Time: r.Time, Error: r.Error})
+		}
+	}
+	return tasks
+}
+
+// Saves the report of a mode to <mode>.json in the directory of the run
+func saveResults(document *report.Document) {
+	if runDir == "" {
+		return
+	}
+	if err := os.MkdirAll(runDir, 0755); err != nil {
+		log.Errorf("Error creating the results directory %s: %s", runDir, err)
+		return
+	}
+	runMetadata.Finish()
+	document.Metadata = runMetadata
+	path := filepath.Join(runDir, document.Mode+".json")
+	f, err := os.Create(path)
+	if err != nil {
+		log.Errorf("Error creating file: %s", err)
+		return
+	}
+	defer f.Close()
+	if err := document.WriteJSON(f); err != nil {
+		log.Errorf("Error saving the results to %s: %s", path, err)
+	}
+}
+
+// Returns the directory of the run, if value is not a directory it is the id of a run of the results directory
+func resolveRunDir(value string) string {
+	if info, err := os.Stat(value); err == nil && info.IsDir() {
+		return value
+	}
+	entry, err := results.Find(config.ResultsDir, value)
+	if err != nil {
+		log.Fatalf("%s is neither a directory nor a run: %s", value, err)
+	}
+	return entry.Dir(config.ResultsDir)
+}
+
+// Prints the runs of the results directory, oldest first
+func printRuns(format string) {
+	entries, err := results.List(config.ResultsDir)
+	if err != nil {
+		log.Fatalf("Failed to read the runs of %s: %s", config.ResultsDir, err)
+	}
+	if format == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(entries)
+		return
+	}
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.AppendHeader(table.Row{"Run", "Host", "Modes", "Started", "Duration", "Config file", "Config hash", "CloudStack version"})
+	for _, entry := range entries {
+		hash := entry.ConfigHash
+		if len(hash) > 12 {
+			hash = hash[:12]
+		}
+		t.AppendRow(table.Row{entry.Run, entry.Host, strings.Join(entry.Modes, ", "), entry.Started.Format(time.RFC3339),
+			entry.Finished.Sub(entry.Started).Round(time.Second).String(), entry.ConfigFile, hash, entry.CloudStackVersion})
+	}
+	renderTable(t, format)
+}
+
+// Prints the settings of the run and the results of each of its modes
+func printRun(id string, format string) {
+	entry, err := results.Find(config.ResultsDir, id)
+	if err != nil {
+		log.Fatalf("Failed to find the run %s: %s", id, err)
+	}
+	dir := entry.Dir(config.ResultsDir)
+	manifest, err := results.LoadManifest(dir)
+	if err != nil {
+		log.Fatalf("Failed to read the manifest of the run %s: %s", entry.Run, err)
+	}
+	if format == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(manifest)
+		return
+	}
+
+	m := manifest.Metadata
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.SetTitle(fmt.Sprintf("Run %s", m.Run))
+	t.AppendRows([]table.Row{
+		{"Directory", dir},
+		{"Host", manifest.Host},
+		{"Modes", strings.Join(m.Modes, ", ")},
+		{"Started", m.Started.Format(time.RFC1123)},
+		{"Finished", m.Finished.Format(time.RFC1123)},
+		{"csbench version", m.CsbenchVersion},
+		{"Command", strings.Join(m.CommandLine, " ")},
+		{"Config file", fmt.Sprintf("%s (%s)", m.ConfigFile, m.ConfigHash)},
+		{"DB profile", m.DBProfile},
+		{"CloudStack version", m.CloudStackVersion},
+		{"Inventory", m.InventorySummary()},
+		{"Files", strings.Join(manifest.Files, ", ")},
+	})
+	renderTable(t, format)
+
+	for _, mode := range m.Modes {
+		document, err := report.Load(filepath.Join(dir, mode+".json"))
+		if err != nil {
+			log.Warnf("No results of %s in the run %s: %s", mode, m.Run, err)
+			continue
+		}
+		fmt.Println()
+		var t table.Writer
+		if len(document.APIs) > 0 {
+			t = newBenchmarkTable(document)
+		} else {
+			t = newTasksTable(document)
+		}
+		t.SetOutputMirror(os.Stdout)
+		t.SetTitle(fmt.Sprintf("%s (passed: %t)", mode, document.Passed))
+		renderTable(t, format)
+	}
+}
+
+// Compares the reports of the current run with the baseline, returns false if there are regressions
+func compareReports(baselineDir string, currentDir string, thresholds compare.Thresholds, format string) bool {
+	baseline, err := compare.Load(baselineDir)
+	if err != nil {
+		log.Fatalf("Error reading the baseline: %s", err)
+	}
+	current, err := compare.Load(currentDir)
+	if err != nil {
+		log.Fatalf("Error reading the current run: %s", err)
+	}
+
+	deltas := compare.Compare(baseline, current, thresholds)
+	compare.Render(deltas, format)
+	regressions := compare.Regressions(deltas)
+	missing := compare.Missing(deltas)
+	if regressions > 0 {
+		log.Errorf("%d runs of APIs regressed compared to the baseline %s (max slowdown %.1f%%, max error rate increase %.2f points, %d missing from the current run%s)",
+			regressions, baselineDir, thresholds.MaxSlowdown, thresholds.MaxErrorRateIncrease, missing, allowedMissing(thresholds))
+		return false
+	}
+	log.Infof("No regressions compared to the baseline %s (%d runs missing from the current run%s)", baselineDir, missing, allowedMissing(thresholds))
+	return true
+}
+
+// Returns the note telling that the missing runs are allowed, if they are
+func allowedMissing(thresholds compare.Thresholds) string {
+	if thresholds.AllowMissing {
+		return ", allowed"
+	}
+	return ""
+}
+
+func usesPlaceholders(benchmarkScenario *scenario.Scenario) bool {
+	for _, testCase := range benchmarkScenario.Cases {
+		if lookup.HasPlaceholders(testCase.Params, "") {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+Creates the resolver of the parameter placeholders, looking up the resources as
+admin. Its calls go through the shared HTTP client without the samples and
+metrics transports, so that they are not counted as calls of the benchmark.
+*/
+func newResolver() *lookup.Resolver {
+	for _, profile := range profiles {
+		if profile.Name == "admin" && !profile.UsesSession() {
+			timeout := httpClient.Timeout
+			if timeout == 0 {
+				timeout = 60 * time.Second
+			}
+			client := &http.Client{Transport: httpClient.Transport, Timeout: timeout}
+			return lookup.NewResolver(cloudstack.NewAsyncClient(config.URL, profile.ApiKey, profile.SecretKey, false, cloudstack.WithHTTPClient(client)), config.ParentDomainId)
+		}
+	}
+	log.Fatal("Failed to find admin profile with an API key, it is needed to resolve the parameter placeholders of the scenario")
+	return nil
+}
+
+// Creates the HTTP client shared by all the calls to the management server
+func newHTTPClient() *http.Client {
+	client, err := httpclient.New(httpclient.Options{
+		Timeout:      config.Timeout,
+		KeepAlive:    config.KeepAlive,
+		MaxIdleConns: config.MaxIdleConns,
+		VerifySSL:    config.VerifySSL,
+		CACert:       config.CACert,
+		ClientCert:   config.ClientCert,
+		ClientKey:    config.ClientKey,
+		Proxy:        config.Proxy,
+		Headers:      config.Headers,
+	})
+	if err != nil {
+		log.Fatalf("Failed to create the HTTP client: %s", err)
+	}
+	return client
+}
+
+// Starts sending the API calls to the time series databases of the config file
+func openSinks(dbProfile int, run string) {
+	tags := map[string]string{"host": config.Host, "dbprofile": strconv.Itoa(dbProfile), "run": run}
+	for name, value := range config.SinkTags {
+		tags[name] = value
+	}
+
+	if config.InfluxURL != "" {
+		metrics.AddSink(metrics.NewInfluxSink(config.InfluxURL, config.InfluxToken, tags, config.SinkInterval))
+	}
+	if config.GraphiteAddress != "" {
+		sink, err := metrics.NewGraphiteSink(config.GraphiteAddress, tags, config.SinkInterval)
+		if err != nil {
+			log.Fatalf("Failed to connect to Graphite at %s: %s", config.GraphiteAddress, err)
+		}
+		metrics.AddSink(sink)
+	}
+	if config.StatsDAddress != "" {
+		sink, err := metrics.NewStatsDSink(config.StatsDAddress, tags, config.SinkInterval)
+		if err != nil {
+			log.Fatalf("Failed to connect to StatsD at %s: %s", config.StatsDAddress, err)
+		}
+		metrics.AddSink(sink)
+	}
+}
+
+// Creates the client used to create, tear down and run actions on the resources
+func newCloudStackClient(apiURL string, profile *config.Profile) *cloudstack.CloudStackClient {
+	timeout := httpClient.Timeout
+	if timeout == 0 {
+		timeout = 60 * time.Second
+	}
+	client := &http.Client{
+		Transport: metrics.NewTransport(samples.NewTransport(httpClient.Transport, profile.Name), profile.Name),
+		Timeout:   timeout,
+	}
+	return cloudstack.NewAsyncClient(apiURL, profile.ApiKey, profile.SecretKey, false, cloudstack.WithHTTPClient(client))
 }
 
 func executeVMAction(vmAction *string, workers *int) map[string][]*Result {
@@ -312,7 +1086,7 @@ func executeVMAction(vmAction *string, workers *int) map[string][]*Result {
 	workerPool := pool.NewWithResults[map[string]*Result]().WithMaxGoroutines(*workers)
 	for _, profile := range profiles {
 		if profile.Name == "admin" {
-			cs = cloudstack.NewAsyncClient(config.URL, profile.ApiKey, profile.SecretKey, false)
+			cs = newCloudStackClient(config.URL, profile)
 			cs.Timeout(time.Duration(300 * time.Second))
 		}
 	}
@@ -333,54 +1107,30 @@ func executeVMAction(vmAction *string, workers *int) map[string][]*Result {
 		allVMs = append(allVMs, vms...)
 	}
 
-	progressMarker := int(math.Max(float64(len(allVMs))/10.0, 5))
 	start := time.Now()
+	var res []map[string]*Result
+	metrics.SetPlanned("vmaction", len(allVMs))
+	if len(config.Stages) > 0 {
+		res = executeVMActionInStages(cs, *vmAction, allVMs)
+	} else {
+		progressMarker := int(math.Max(float64(len(allVMs))/10.0, 5))
+		for i, virtualMachine := range allVMs {
+			virtualMachine := virtualMachine
+
+			if (i+1)%progressMarker == 0 {
+				log.Infof("Executed %d VMs", i+1)
+			}
 
-	for i, virtualMachine := range allVMs {
-		virtualMachine := virtualMachine
-
-		if (i+1)%progressMarker == 0 {
-			log.Infof("Executed %d VMs", i+1)
-		}
+			if *vmAction == "random" && rand.Intn(100) < 50 {
+				continue
+			}
 
-		if *vmAction == "random" && rand.Intn(100) < 50 {
-			continue
+			workerPool.Go(func() map[string]*Result {
+				return runVMAction(cs, *vmAction, virtualMachine)
+			})
 		}
-
-		workerPool.Go(func() map[string]*Result {
-			taskStart := time.Now()
-			result := false
-			action := "skipped"
-			switch virtualMachine.State {
-			case "Running":
-				if *vmAction == "stop" || *vmAction == "toggle" || *vmAction == "random" {
-					err := vm.StopVM(cs, virtualMachine.Id)
-					result = err == nil
-					action = "stop"
-				} else if *vmAction == "reboot" {
-					err := vm.RebootVM(cs, virtualMachine.Id)
-					result = err == nil
-					action = "reboot"
-				}
-			case "Stopped":
-				if *vmAction == "start" || *vmAction == "toggle" || *vmAction == "random" {
-					err := vm.StartVM(cs, virtualMachine.Id)
-					result = err == nil
-					action = "start"
-				} else if *vmAction == "reboot" {
-					result = false
-					action = "stop"
-				}
-			}
-			return map[string]*Result{
-				action: {
-					Success:  result,
-					Duration: time.Since(taskStart).Seconds(),
-				},
-			}
-		})
+		res = workerPool.Wait()
 	}
-	res := workerPool.Wait()
 	log.Infof("Executed %s on %d VMs in %.2f seconds", *vmAction, len(allVMs), time.Since(start).Seconds())
 	var results = make(map[string][]*Result)
 	for _, result := range res {
@@ -395,6 +1145,86 @@ func executeVMAction(vmAction *string, workers *int) map[string][]*Result {
 	return results
 }
 
+// Runs the action on the VMs with as many workers as the stages ask for. VMs left when the stages are done are skipped.
+func executeVMActionInStages(cs *cloudstack.CloudStackClient, vmAction string, allVMs []*cloudstack.VirtualMachine) []map[string]*Result {
+	log.Infof("Executing %s on %d VMs with stages %s", vmAction, len(allVMs), loadprofile.Format(config.Stages))
+	var lock sync.Mutex
+	var res []map[string]*Result
+	next := 0
+	loadprofile.Run(config.Stages, func(stage int) bool {
+		lock.Lock()
+		for next < len(allVMs) && vmAction == "random" && rand.Intn(100) < 50 {
+			next++
+		}
+		if next >= len(allVMs) {
+			lock.Unlock()
+			return false
+		}
+		virtualMachine := allVMs[next]
+		next++
+		lock.Unlock()
+
+		result := runVMAction(cs, vmAction, virtualMachine)
+		for _, value := range result {
+			value.Stage = stage
+		}
+
+		lock.Lock()
+		res = append(res, result)
+		lock.Unlock()
+		return true
+	})
+
+	if next < len(allVMs) {
+		log.Warnf("Stages finished before executing %s on %d VMs", vmAction, len(allVMs)-next)
+	}
+	return res
+}
+
+func runVMAction(cs *cloudstack.CloudStackClient, vmAction string, virtualMachine *cloudstack.VirtualMachine) map[string]*Result {
+	taskStart := time.Now()
+	result := false
+	action := "skipped"
+	var taskErr *failure.Error
+	switch virtualMachine.State {
+	case "Running":
+		if vmAction == "stop" || vmAction == "toggle" || vmAction == "random" {
+			err := vm.StopVM(cs, virtualMachine.Id)
+			result = err == nil
+			taskErr = failure.FromError("stopVirtualMachine", err)
+			action = "stop"
+		} else if vmAction == "reboot" {
+			err := vm.RebootVM(cs, virtualMachine.Id)
+			result = err == nil
+			taskErr = failure.FromError("rebootVirtualMachine", err)
+			action = "reboot"
+		}
+	case "Stopped":
+		if vmAction == "start" || vmAction == "toggle" || vmAction == "random" {
+			err := vm.StartVM(cs, virtualMachine.Id)
+			result = err == nil
+			taskErr = failure.FromError("startVirtualMachine", err)
+			action = "start"
+		} else if vmAction == "reboot" {
+			result = false
+			taskErr = failure.New("rebootVirtualMachine", failure.Unknown, 0, "VM is stopped")
+			action = "stop"
+		}
+	}
+	if !result && taskErr == nil && action == "skipped" {
+		taskErr = failure.New(vmAction, failure.Unknown, 0, "VM is "+virtualMachine.State)
+	}
+	metrics.TaskDone("vmaction", result)
+	return map[string]*Result{
+		action: {
+			Success:  result,
+			Duration: time.Since(taskStart).Seconds(),
+			Error:    taskErr,
+			Time:     time.Now(),
+		},
+	}
+}
+
 func createResources(domainFlag, limitsFlag, networkFlag, vmFlag, volumeFlag *bool, workers *int) map[string][]*Result {
 	apiURL := config.URL
 
@@ -405,7 +1235,7 @@ func createResources(domainFlag, limitsFlag, networkFlag, vmFlag, volumeFlag *bo
 			numVmsPerNetwork := config.NumVms
 			numVolumesPerVM := config.NumVolumes
 
-			cs := cloudstack.NewAsyncClient(apiURL, profile.ApiKey, profile.SecretKey, false)
+			cs := newCloudStackClient(apiURL, profile)
 
 			var results = make(map[string][]*Result)
 
@@ -460,17 +1290,19 @@ func createDomains(workerPool *pool.ResultPool[*Result], cs *cloudstack.CloudSta
 	progressMarker := int(math.Max(float64(count)/10.0, 5))
 	start := time.Now()
 	log.Infof("Creating %d domains", count)
+	metrics.SetPlanned("domain", count)
 	for i := 0; i < count; i++ {
 		if (i+1)%progressMarker == 0 {
 			log.Infof("Created %d domains", i+1)
 		}
-		workerPool.Go(func() *Result {
+		workerPool.Go(trackTask("domain", func() *Result {
 			taskStart := time.Now()
 			dmn, err := domain.CreateDomain(cs, parentDomainId)
 			if err != nil {
 				return &Result{
 					Success:  false,
 					Duration: time.Since(taskStart).Seconds(),
+					Error:    failure.FromError("createDomain", err),
 				}
 			}
 			_, err = domain.CreateAccount(cs, dmn.Id)
@@ -478,6 +1310,7 @@ func createDomains(workerPool *pool.ResultPool[*Result], cs *cloudstack.CloudSta
 				return &Result{
 					Success:  false,
 					Duration: time.Since(taskStart).Seconds(),
+					Error:    failure.FromError("createAccount", err),
 				}
 			}
 
@@ -485,7 +1318,7 @@ func createDomains(workerPool *pool.ResultPool[*Result], cs *cloudstack.CloudSta
 				Success:  true,
 				Duration: time.Since(taskStart).Seconds(),
 			}
-		})
+		}))
 	}
 	res := workerPool.Wait()
 	log.Infof("Created %d domains in %.2f seconds", count, time.Since(start).Seconds())
@@ -503,19 +1336,24 @@ func updateLimits(workerPool *pool.ResultPool[*Result], cs *cloudstack.CloudStac
 	progressMarker := int(math.Max(float64(len(accounts))/10.0, 5))
 	start := time.Now()
 	log.Infof("Updating limits for %d accounts", len(accounts))
+	metrics.SetPlanned("limits", len(accounts))
 	for i, account := range accounts {
 		if (i+1)%progressMarker == 0 {
 			log.Infof("Updated limits for %d accounts", i+1)
 		}
 		account := account
-		workerPool.Go(func() *Result {
+		workerPool.Go(trackTask("limits", func() *Result {
 			taskStart := time.Now()
 			resp := domain.UpdateLimits(cs, account)
-			return &Result{
+			result := &Result{
 				Success:  resp,
 				Duration: time.Since(taskStart).Seconds(),
 			}
-		})
+			if !resp {
+				result.Error = failure.New("updateResourceLimit", failure.Unknown, 0, "failed to update the limits of "+account.Name)
+			}
+			return result
+		}))
 	}
 	res := workerPool.Wait()
 	log.Infof("Updated limits for %d accounts in %.2f seconds", len(accounts), time.Since(start).Seconds())
@@ -530,6 +1368,7 @@ func createNetwork(workerPool *pool.ResultPool[*Result], cs *cloudstack.CloudSta
 	counter := 0
 	start := time.Now()
 	log.Infof("Creating %d networks", len(domains)*numNetworkPerDomain)
+	metrics.SetPlanned("network", len(domains)*numNetworkPerDomain)
 	for _, dmn := range domains {
 		for j := 1; j <= numNetworkPerDomain; j++ {
 			networkIdx := counter
@@ -539,20 +1378,21 @@ func createNetwork(workerPool *pool.ResultPool[*Result], cs *cloudstack.CloudSta
 				log.Infof("Created %d networks", counter)
 			}
 
-			workerPool.Go(func() *Result {
+			workerPool.Go(trackTask("network", func() *Result {
 				taskStart := time.Now()
 				_, err := network.CreateNetwork(cs, dmn.Id, networkIdx)
 				if err != nil {
 					return &Result{
 						Success:  false,
 						Duration: time.Since(taskStart).Seconds(),
+						Error:    failure.FromError("createNetwork", err),
 					}
 				}
 				return &Result{
 					Success:  true,
 					Duration: time.Since(taskStart).Seconds(),
 				}
-			})
+			}))
 		}
 	}
 	res := workerPool.Wait()
@@ -585,6 +1425,7 @@ func createVms(workerPool *pool.ResultPool[*Result], cs *cloudstack.CloudStackCl
 	counter := 0
 	start := time.Now()
 	log.Infof("Creating %d VMs", len(allNetworks)*numVmPerNetwork)
+	metrics.SetPlanned("vm", len(allNetworks)*numVmPerNetwork)
 	for _, network := range allNetworks {
 		network := network
 		for j := 1; j <= numVmPerNetwork; j++ {
@@ -592,20 +1433,21 @@ func createVms(workerPool *pool.ResultPool[*Result], cs *cloudstack.CloudStackCl
 			if counter%progressMarker == 0 {
 				log.Infof("Created %d VMs", counter)
 			}
-			workerPool.Go(func() *Result {
+			workerPool.Go(trackTask("vm", func() *Result {
 				taskStart := time.Now()
 				_, err := vm.DeployVm(cs, network.Domainid, network.Id, domainIdAccountMapping[network.Domainid].Name)
 				if err != nil {
 					return &Result{
 						Success:  false,
 						Duration: time.Since(taskStart).Seconds(),
+						Error:    failure.FromError("deployVirtualMachine", err),
 					}
 				}
 				return &Result{
 					Success:  true,
 					Duration: time.Since(taskStart).Seconds(),
 				}
-			})
+			}))
 		}
 	}
 	res := workerPool.Wait()
@@ -630,6 +1472,7 @@ func createVolumes(workerPool *pool.ResultPool[*Result], cs *cloudstack.CloudSta
 	start := time.Now()
 
 	log.Infof("Creating %d volumes", len(allVMs)*numVolumesPerVM)
+	metrics.SetPlanned("volume", len(allVMs)*numVolumesPerVM)
 	unsuitableVmCount := 0
 	counter := 0
 
@@ -645,13 +1488,14 @@ func createVolumes(workerPool *pool.ResultPool[*Result], cs *cloudstack.CloudSta
 				log.Infof("Created %d volumes", counter)
 			}
 
-			workerPool.Go(func() *Result {
+			workerPool.Go(trackTask("volume", func() *Result {
 				taskStart := time.Now()
 				vol, err := volume.CreateVolume(cs, vm.Domainid, vm.Account)
 				if err != nil {
 					return &Result{
 						Success:  false,
 						Duration: time.Since(taskStart).Seconds(),
+						Error:    failure.FromError("createVolume", err),
 					}
 				}
 				_, err = volume.AttachVolume(cs, vol.Id, vm.Id)
@@ -659,13 +1503,14 @@ func createVolumes(workerPool *pool.ResultPool[*Result], cs *cloudstack.CloudSta
 					return &Result{
 						Success:  false,
 						Duration: time.Since(taskStart).Seconds(),
+						Error:    failure.FromError("attachVolume", err),
 					}
 				}
 				return &Result{
 					Success:  true,
 					Duration: time.Since(taskStart).Seconds(),
 				}
-			})
+			}))
 		}
 	}
 	if unsuitableVmCount > 0 {
@@ -682,7 +1527,7 @@ func tearDownEnv(domainFlag, networkFlag, vmFlag, volumeFlag *bool, workers *int
 	for _, profile := range profiles {
 		userProfileName := profile.Name
 		if userProfileName == "admin" {
-			cs := cloudstack.NewAsyncClient(apiURL, profile.ApiKey, profile.SecretKey, false)
+			cs := newCloudStackClient(apiURL, profile)
 
 			var results = make(map[string][]*Result)
 
@@ -729,6 +1574,7 @@ func destroyVms(workerPool *pool.ResultPool[*Result], cs *cloudstack.CloudStackC
 	start := time.Now()
 
 	log.Infof("Destroying %d VMs", len(allVMs))
+	metrics.SetPlanned("vm-destroy", len(allVMs))
 
 	for i, virtualMachine := range allVMs {
 		virtualMachine := virtualMachine
@@ -736,20 +1582,21 @@ func destroyVms(workerPool *pool.ResultPool[*Result], cs *cloudstack.CloudStackC
 			log.Infof("Destroyed %d VMs", i+1)
 		}
 
-		workerPool.Go(func() *Result {
+		workerPool.Go(trackTask("vm-destroy", func() *Result {
 			taskStart := time.Now()
 			err := vm.DestroyVm(cs, virtualMachine.Id)
 			if err != nil {
 				return &Result{
 					Success:  false,
 					Duration: time.Since(taskStart).Seconds(),
+					Error:    failure.FromError("destroyVirtualMachine", err),
 				}
 			}
 			return &Result{
 				Success:  true,
 				Duration: time.Since(taskStart).Seconds(),
 			}
-		})
+		}))
 	}
 
 	res := workerPool.Wait()
@@ -771,25 +1618,27 @@ func deleteNetworks(workerPool *pool.ResultPool[*Result], cs *cloudstack.CloudSt
 	progressMarker := int(math.Max(float64(len(allNetworks))/10.0, 5))
 	start := time.Now()
 	log.Infof("Deleting %d networks", len(allNetworks))
+	metrics.SetPlanned("network-delete", len(allNetworks))
 	for i, net := range allNetworks {
 		net := net
 		if (i+1)%progressMarker == 0 {
 			log.Infof("Deleted %d networks", i+1)
 		}
-		workerPool.Go(func() *Result {
+		workerPool.Go(trackTask("network-delete", func() *Result {
 			taskStart := time.Now()
 			resp, err := network.DeleteNetwork(cs, net.Id)
 			if err != nil || !resp {
 				return &Result{
 					Success:  false,
 					Duration: time.Since(taskStart).Seconds(),
+					Error:    deleteError("deleteNetwork", err),
 				}
 			}
 			return &Result{
 				Success:  true,
 				Duration: time.Since(taskStart).Seconds(),
 			}
-		})
+		}))
 	}
 	res := workerPool.Wait()
 	log.Infof("Deleted %d networks in %.2f seconds", len(allNetworks), time.Since(start).Seconds())
@@ -810,25 +1659,27 @@ func deleteVolumes(workerPool *pool.ResultPool[*Result], cs *cloudstack.CloudSta
 	progressMarker := int(math.Max(float64(len(allVolumes))/10.0, 5))
 	start := time.Now()
 	log.Infof("Deleting %d volumes", len(allVolumes))
+	metrics.SetPlanned("volume-delete", len(allVolumes))
 	for i, vol := range allVolumes {
 		vol := vol
 		if (i+1)%progressMarker == 0 {
 			log.Infof("Deleted %d volumes", i+1)
 		}
-		workerPool.Go(func() *Result {
+		workerPool.Go(trackTask("volume-delete", func() *Result {
 			taskStart := time.Now()
 			_, err := volume.DestroyVolume(cs, vol.Id)
 			if err != nil {
 				return &Result{
 					Success:  false,
 					Duration: time.Since(taskStart).Seconds(),
+					Error:    failure.FromError("destroyVolume", err),
 				}
 			}
 			return &Result{
 				Success:  true,
 				Duration: time.Since(taskStart).Seconds(),
 			}
-		})
+		}))
 	}
 	res := workerPool.Wait()
 	log.Infof("Deleted %d volumes in %.2f seconds", len(allVolumes), time.Since(start).Seconds())
@@ -842,27 +1693,47 @@ func deleteDomains(workerPool *pool.ResultPool[*Result], cs *cloudstack.CloudSta
 	progressMarker := int(math.Max(float64(len(domains))/10.0, 5))
 	start := time.Now()
 	log.Infof("Deleting %d domains", len(domains))
+	metrics.SetPlanned("domain-delete", len(domains))
 	for i, dmn := range domains {
 		dmn := dmn
 		if (i+1)%progressMarker == 0 {
 			log.Infof("Deleted %d domains", i+1)
 		}
-		workerPool.Go(func() *Result {
+		workerPool.Go(trackTask("domain-delete", func() *Result {
 			taskStart := time.Now()
 			resp, err := domain.DeleteDomain(cs, dmn.Id)
 			if !resp || err != nil {
 				return &Result{
 					Success:  false,
 					Duration: time.Since(taskStart).Seconds(),
+					Error:    deleteError("deleteDomain", err),
 				}
 			}
 			return &Result{
 				Success:  true,
 				Duration: time.Since(taskStart).Seconds(),
 			}
-		})
+		}))
 	}
 	res := workerPool.Wait()
 	log.Infof("Deleted %d domains in %.2f seconds", len(domains), time.Since(start).Seconds())
 	return res
 }
+
+// Counts the task in the metrics when it is done, and records when it finished
+func trackTask(task string, run func() *Result) func() *Result {
+	return func() *Result {
+		result := run()
+		result.Time = time.Now()
+		metrics.TaskDone(task, result.Success)
+		return result
+	}
+}
+
+// Returns the error of a delete call, which can also fail by returning false
+func deleteError(operation string, err error) *failure.Error {
+	if err != nil {
+		return failure.FromError(operation, err)
+	}
+	return failure.New(operation, failure.Unknown, 0, "the API returned false")
+}
@@ -0,0 +1,210 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package failure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/apache/cloudstack-go/v2/cloudstack"
+)
+
+type Category string
+
+const (
+	// The call could not be sent or its response could not be read
+	Transport Category = "transport"
+	// The call, or the async job it started, took too long
+	Timeout Category = "timeout"
+	// The server answered with an HTTP error and no CloudStack error
+	HTTPStatus Category = "http"
+	// The server answered with a CloudStack error code
+	CloudStack Category = "cloudstack"
+	// The response is not the JSON expected
+	Parse Category = "parse"
+	// The response breaks the validation rules of the case, e.g. fewer items than its count
+	Validation Category = "validation"
+	// The operation failed without an error, e.g. a delete returning false
+	Unknown Category = "unknown"
+)
+
+// A failed operation
+type Error struct {
+	Category Category
+	// HTTP status or CloudStack error code, 0 if none
+	Code    int
+	Message string
+	// API or action that failed, like deployVirtualMachine
+	Operation string
+}
+
+func New(operation string, category Category, code int, message string) *Error {
+	return &Error{Category: category, Code: code, Message: message, Operation: operation}
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Operation, e.Describe())
+}
+
+// Returns the category, code and message of the error, without the operation
+func (e *Error) Describe() string {
+	if e.Code != 0 {
+		return fmt.Sprintf("%s %d: %s", e.Category, e.Code, e.Message)
+	}
+	return fmt.Sprintf("%s: %s", e.Category, e.Message)
+}
+
+// The errors of the cloudstack-go client, like "CloudStack API error 530
+// (CSExceptionErrorCode: 4250): Unable to create a deployment" or the result of
+// a failed async job, {"errorcode":530,"errortext":"..."}
+var (
+	apiErrorRegex = regexp.MustCompile(`CloudStack API error (\d+) \(CSExceptionErrorCode: \d+\): (.*)`)
+	jobErrorRegex = regexp.MustCompile(`"errorcode"\s*:\s*(\d+)`)
+	jobErrorText  = regexp.MustCompile(`"errortext"\s*:\s*"((?:[^"\\]|\\.)*)"`)
+	uuidRegex     = regexp.MustCompile(`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`)
+	// The query of a URL, like the one net/http adds to the errors of GET calls
+	queryRegex = regexp.MustCompile(`(https?://[^\s"?]*)\?[^\s"]*`)
+)
+
+// Longest message kept in the key of an error
+const maxMessageSize = 200
+
+/*
+Returns the text of the error with the queries of the URLs in it removed. The
+errors of net/http have the URL of the call, whose query has the API key and
+signature, or the session key, and differs for every call.
+*/
+func Message(err error) string {
+	return queryRegex.ReplaceAllString(err.Error(), "$1")
+}
+
+// Classifies an error returned by net/http or by the cloudstack-go client
+func FromError(operation string, err error) *Error {
+	if err == nil {
+		return nil
+	}
+	message := Message(err)
+	if match := apiErrorRegex.FindStringSubmatch(message); match != nil {
+		code, _ := strconv.Atoi(match[1])
+		return New(operation, CloudStack, code, match[2])
+	}
+	if match := jobErrorRegex.FindStringSubmatch(message); match != nil {
+		code, _ := strconv.Atoi(match[1])
+		if text := jobErrorText.FindStringSubmatch(message); text != nil {
+			message = text[1]
+		}
+		return New(operation, CloudStack, code, message)
+	}
+
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, cloudstack.AsyncTimeoutErr) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return New(operation, Timeout, 0, message)
+	}
+	if strings.Contains(message, "invalid character") || strings.Contains(message, "unexpected end of JSON") {
+		return New(operation, Parse, 0, message)
+	}
+	return New(operation, Transport, 0, message)
+}
+
+// Returns the key grouping similar errors, with the ids of the resources
+// removed from the message and long messages cut
+func (e *Error) Key() string {
+	message := uuidRegex.ReplaceAllString(e.Message, "<id>")
+	if len(message) > maxMessageSize {
+		message = message[:maxMessageSize] + "..."
+	}
+	return fmt.Sprintf("%s|%s|%d|%s", e.Operation, e.Category, e.Code, message)
+}
+
+// A group of similar errors
+type Count struct {
+	// First error of the group
+	Error *Error
+	Count int
+}
+
+// Counts the errors by kind. Safe to use from multiple goroutines.
+type Counter struct {
+	lock   sync.Mutex
+	counts map[string]*Count
+	total  int
+}
+
+func NewCounter() *Counter {
+	return &Counter{counts: make(map[string]*Count)}
+}
+
+func (c *Counter) Add(err *Error) {
+	if err == nil {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	key := err.Key()
+	if count, ok := c.counts[key]; ok {
+		count.Count++
+	} else {
+		c.counts[key] = &Count{Error: err, Count: 1}
+	}
+	c.total++
+}
+
+func (c *Counter) Total() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.total
+}
+
+// Returns the n most frequent kinds of errors, all of them if n is 0
+func (c *Counter) Top(n int) []*Count {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	counts := make([]*Count, 0, len(c.counts))
+	for _, count := range c.counts {
+		counts = append(counts, count)
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		return counts[i].Error.Key() < counts[j].Error.Key()
+	})
+	if n > 0 && len(counts) > n {
+		counts = counts[:n]
+	}
+	return counts
+}
+
+// Formats the n most frequent kinds of errors on one line, for the CSV reports of a single operation
+func (c *Counter) Summary(n int) string {
+	var parts []string
+	for _, count := range c.Top(n) {
+		parts = append(parts, fmt.Sprintf("%dx %s", count.Count, count.Error.Describe()))
+	}
+	if len(parts) == 0 {
+		return "-"
+	}
+	return strings.Join(parts, "; ")
+}
@@ -0,0 +1,160 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package failure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/apache/cloudstack-go/v2/cloudstack"
+)
+
+// A timeout of the client, like the ones of http.Client
+type timeoutError struct{}
+
+func (timeoutError) Error() string {
+	return "context deadline exceeded (Client.Timeout exceeded while awaiting headers)"
+}
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// Returns the error of a GET call signed with the signature, as returned by http.Client
+func getError(signature string, err error) error {
+	return &url.Error{
+		Op:  "Get",
+		URL: "http://10.0.3.5:8080/client/api?apiKey=key&command=listVirtualMachines&expires=2024-01-10T10%3A12%3A53%2B0000&signature=" + signature,
+		Err: err,
+	}
+}
+
+func TestFromError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want *Error
+	}{
+		{"nil", nil, nil},
+		{"API error", errors.New("CloudStack API error 530 (CSExceptionErrorCode: 4250): Unable to create a deployment for VM"),
+			New("deployVirtualMachine", CloudStack, 530, "Unable to create a deployment for VM")},
+		{"failed job", errors.New(`{"errorcode":431,"errortext":"Unable to find \"vm\""}`),
+			New("deployVirtualMachine", CloudStack, 431, `Unable to find \"vm\"`)},
+		{"client timeout", getError("abc", timeoutError{}),
+			New("deployVirtualMachine", Timeout, 0, `Get "http://10.0.3.5:8080/client/api": context deadline exceeded (Client.Timeout exceeded while awaiting headers)`)},
+		{"deadline", fmt.Errorf("waiting: %w", context.DeadlineExceeded),
+			New("deployVirtualMachine", Timeout, 0, "waiting: context deadline exceeded")},
+		{"async job timeout", cloudstack.AsyncTimeoutErr,
+			New("deployVirtualMachine", Timeout, 0, "Timeout while waiting for async job to finish")},
+		{"invalid JSON", errors.New("invalid character '<' looking for beginning of value"),
+			New("deployVirtualMachine", Parse, 0, "invalid character '<' looking for beginning of value")},
+		{"connection refused", getError("abc", errors.New("dial tcp 10.0.3.5:8080: connect: connection refused")),
+			New("deployVirtualMachine", Transport, 0, `Get "http://10.0.3.5:8080/client/api": dial tcp 10.0.3.5:8080: connect: connection refused`)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := FromError("deployVirtualMachine", test.err); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("FromError() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestTimeoutsShareKey(t *testing.T) {
+	first := FromError("listVirtualMachines", getError("c2lnbmF0dXJlMQ%3D%3D", timeoutError{}))
+	second := FromError("listVirtualMachines", getError("c2lnbmF0dXJlMg%3D%3D", timeoutError{}))
+	if first.Key() != second.Key() {
+		t.Errorf("keys of two timeouts differ: %q and %q", first.Key(), second.Key())
+	}
+	for _, secret := range []string{"apiKey", "signature", "expires"} {
+		if strings.Contains(first.Message, secret) {
+			t.Errorf("message %q has the %s", first.Message, secret)
+		}
+	}
+}
+
+func TestMessage(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{errors.New("connection reset by peer"), "connection reset by peer"},
+		{getError("abc", errors.New("EOF")), `Get "http://10.0.3.5:8080/client/api": EOF`},
+		{fmt.Errorf("login failed: %v", &url.Error{Op: "Post", URL: "https://cs/client/api?sessionkey=secret", Err: errors.New("EOF")}),
+			`login failed: Post "https://cs/client/api": EOF`},
+	}
+	for _, test := range tests {
+		if got := Message(test.err); got != test.want {
+			t.Errorf("Message() = %q, want %q", got, test.want)
+		}
+	}
+}
+
+func TestKey(t *testing.T) {
+	long := strings.Repeat("a", maxMessageSize+10)
+	tests := []struct {
+		name string
+		err  *Error
+		want string
+	}{
+		{"ids removed", New("startVirtualMachine", CloudStack, 431, "Unable to find vm 0b1f2c3d-4e5f-6071-8293-a4b5c6d7e8f9"),
+			"startVirtualMachine|cloudstack|431|Unable to find vm <id>"},
+		{"long message cut", New("listHosts", Transport, 0, long),
+			"listHosts|transport|0|" + long[:maxMessageSize] + "..."},
+		{"status", New("listHosts", HTTPStatus, 503, "Service Unavailable"), "listHosts|http|503|Service Unavailable"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.err.Key(); got != test.want {
+				t.Errorf("Key() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCounter(t *testing.T) {
+	counter := NewCounter()
+	counter.Add(nil)
+	for i := 0; i < 3; i++ {
+		counter.Add(New("listHosts", Timeout, 0, "timed out"))
+	}
+	counter.Add(New("listHosts", CloudStack, 431, "Unable to find host 0b1f2c3d-4e5f-6071-8293-a4b5c6d7e8f9"))
+	counter.Add(New("listHosts", CloudStack, 431, "Unable to find host 1b1f2c3d-4e5f-6071-8293-a4b5c6d7e8f9"))
+	counter.Add(New("listHosts", HTTPStatus, 503, "Service Unavailable"))
+
+	if total := counter.Total(); total != 6 {
+		t.Errorf("Total() = %d, want 6", total)
+	}
+	var counts []int
+	for _, count := range counter.Top(0) {
+		counts = append(counts, count.Count)
+	}
+	if want := []int{3, 2, 1}; !reflect.DeepEqual(counts, want) {
+		t.Errorf("counts of Top(0) = %v, want %v", counts, want)
+	}
+	want := "3x timeout: timed out; 2x cloudstack 431: Unable to find host 0b1f2c3d-4e5f-6071-8293-a4b5c6d7e8f9"
+	if summary := counter.Summary(2); summary != want {
+		t.Errorf("Summary(2) = %q, want %q", summary, want)
+	}
+	if summary := NewCounter().Summary(3); summary != "-" {
+		t.Errorf("Summary() without errors = %q, want -", summary)
+	}
+}
@@ -0,0 +1,96 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package histogram
+
+import (
+	"strconv"
+	"sync"
+)
+
+// Upper bounds in seconds of the latency buckets, from a few milliseconds for
+// cached list calls up to the minutes some async jobs take.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300}
+
+// A latency histogram with fixed buckets. Safe to use from multiple goroutines.
+type Histogram struct {
+	lock    sync.Mutex
+	buckets []float64
+	// counts[i] is the number of values in (buckets[i-1], buckets[i]], the
+	// last one counts the values above the highest bucket
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func New(buckets []float64) *Histogram {
+	return &Histogram{
+		buckets: buckets,
+		counts:  make([]uint64, len(buckets)+1),
+	}
+}
+
+func (h *Histogram) Observe(value float64) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	i := 0
+	for i < len(h.buckets) && value > h.buckets[i] {
+		i++
+	}
+	h.counts[i]++
+	h.count++
+	h.sum += value
+}
+
+// Returns the upper bound of every bucket, +Inf for the last one
+func (h *Histogram) Labels() []string {
+	labels := make([]string, 0, len(h.counts))
+	for _, bucket := range h.buckets {
+		labels = append(labels, strconv.FormatFloat(bucket, 'f', -1, 64))
+	}
+	return append(labels, "+Inf")
+}
+
+// Returns the number of values in every bucket, in the order of Labels
+func (h *Histogram) Counts() []uint64 {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	counts := make([]uint64, len(h.counts))
+	copy(counts, h.counts)
+	return counts
+}
+
+// Returns the number of values in every bucket and below it, in the order of Labels
+func (h *Histogram) Cumulative() []uint64 {
+	counts := h.Counts()
+	for i := 1; i < len(counts); i++ {
+		counts[i] += counts[i-1]
+	}
+	return counts
+}
+
+func (h *Histogram) Count() uint64 {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return h.count
+}
+
+func (h *Histogram) Sum() float64 {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return h.sum
+}
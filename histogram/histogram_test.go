@@ -0,0 +1,92 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package histogram
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestObserve(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []float64
+		counts []uint64
+	}{
+		{"empty", nil, []uint64{0, 0, 0, 0}},
+		{"inside the buckets", []float64{0.05, 0.2, 0.7}, []uint64{1, 1, 1, 0}},
+		// A value equal to the upper bound of a bucket is counted in it
+		{"on the bounds", []float64{0.1, 0.5, 1}, []uint64{1, 1, 1, 0}},
+		{"above the buckets", []float64{1.5, 60}, []uint64{0, 0, 0, 2}},
+		{"zero", []float64{0}, []uint64{1, 0, 0, 0}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h := New([]float64{0.1, 0.5, 1})
+			sum := 0.0
+			for _, value := range test.values {
+				h.Observe(value)
+				sum += value
+			}
+			if counts := h.Counts(); !reflect.DeepEqual(counts, test.counts) {
+				t.Errorf("Counts() = %v, want %v", counts, test.counts)
+			}
+			if count := h.Count(); count != uint64(len(test.values)) {
+				t.Errorf("Count() = %d, want %d", count, len(test.values))
+			}
+			if h.Sum() != sum {
+				t.Errorf("Sum() = %g, want %g", h.Sum(), sum)
+			}
+		})
+	}
+}
+
+func TestLabelsAndCumulative(t *testing.T) {
+	h := New([]float64{0.005, 0.25, 2.5})
+	for _, value := range []float64{0.001, 0.1, 0.2, 3} {
+		h.Observe(value)
+	}
+	if labels := h.Labels(); !reflect.DeepEqual(labels, []string{"0.005", "0.25", "2.5", "+Inf"}) {
+		t.Errorf("Labels() = %q", labels)
+	}
+	if cumulative := h.Cumulative(); !reflect.DeepEqual(cumulative, []uint64{1, 3, 3, 4}) {
+		t.Errorf("Cumulative() = %v, want [1 3 3 4]", cumulative)
+	}
+}
+
+func TestConcurrentObserve(t *testing.T) {
+	h := New(DefaultBuckets)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				h.Observe(0.01)
+			}
+		}()
+	}
+	wg.Wait()
+	if h.Count() != 1000 {
+		t.Errorf("Count() = %d, want 1000", h.Count())
+	}
+	if cumulative := h.Cumulative(); cumulative[len(cumulative)-1] != 1000 {
+		t.Errorf("last cumulative count = %d, want 1000", cumulative[len(cumulative)-1])
+	}
+}
@@ -0,0 +1,217 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package htmlreport
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Values of a chart, one per label
+type Series struct {
+	Name   string
+	Values []float64
+}
+
+var colors = []string{"#2f6db5", "#e8833a", "#3aa655", "#d64545", "#8a5cc2", "#8c6d31", "#d36fb0", "#666666"}
+
+const (
+	chartHeight  = 280
+	minWidth     = 560
+	marginLeft   = 60
+	marginRight  = 15
+	marginTop    = 40
+	marginBottom = 80
+	// Most labels written under the x axis, the others are skipped
+	maxLabels = 30
+)
+
+// Draws a bar per series for every label, like the percentiles of every API
+func BarChart(title string, unit string, labels []string, series []Series) template.HTML {
+	width := chartWidth(len(labels) * len(series) * 10)
+	c := newChart(title, unit, width, labels, series)
+	groupWidth := c.plotWidth() / float64(len(labels))
+	barWidth := groupWidth * 0.8 / float64(len(series))
+	for i := range labels {
+		for j, s := range series {
+			if i >= len(s.Values) {
+				continue
+			}
+			x := c.x(i) + groupWidth*0.1 + float64(j)*barWidth
+			y := c.y(s.Values[i])
+			fmt.Fprintf(&c.b, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s"><title>%s: %s</title></rect>`,
+				x, y, math.Max(barWidth-1, 1), float64(marginTop+c.plotHeight())-y, colors[j%len(colors)],
+				html.EscapeString(strings.TrimSpace(labels[i]+" "+s.Name)), formatValue(s.Values[i], unit))
+		}
+	}
+	return c.finish(labels, false)
+}
+
+// Draws a line per series, like the calls per second over the run
+func LineChart(title string, unit string, labels []string, series []Series) template.HTML {
+	width := chartWidth(len(labels) * 3)
+	c := newChart(title, unit, width, labels, series)
+	for j, s := range series {
+		points := make([]string, 0, len(s.Values))
+		for i, value := range s.Values {
+			points = append(points, fmt.Sprintf("%.1f,%.1f", c.center(i), c.y(value)))
+		}
+		fmt.Fprintf(&c.b, `<polyline fill="none" stroke="%s" stroke-width="1.5" points="%s"/>`, colors[j%len(colors)], strings.Join(points, " "))
+		// Short runs get a marker on every point, a single point has no line
+		if len(s.Values) <= maxLabels {
+			for i, value := range s.Values {
+				fmt.Fprintf(&c.b, `<circle cx="%.1f" cy="%.1f" r="3" fill="%s"><title>%s %s: %s</title></circle>`,
+					c.center(i), c.y(value), colors[j%len(colors)], html.EscapeString(labels[i]), html.EscapeString(s.Name), formatValue(value, unit))
+			}
+		}
+	}
+	return c.finish(labels, true)
+}
+
+func chartWidth(content int) int {
+	if width := marginLeft + marginRight + content; width > minWidth {
+		return width
+	}
+	return minWidth
+}
+
+type chart struct {
+	b      strings.Builder
+	width  int
+	count  int
+	maxY   float64
+	unit   string
+	series []Series
+}
+
+func newChart(title string, unit string, width int, labels []string, series []Series) *chart {
+	c := &chart{width: width, count: len(labels), unit: unit, series: series}
+	for _, s := range series {
+		for _, value := range s.Values {
+			c.maxY = math.Max(c.maxY, value)
+		}
+	}
+	c.maxY = niceCeiling(c.maxY)
+	if c.count == 0 {
+		c.count = 1
+	}
+
+	fmt.Fprintf(&c.b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`, width, chartHeight, width, chartHeight)
+	fmt.Fprintf(&c.b, `<text x="%d" y="16" style="font-size:13px;font-weight:bold">%s</text>`, marginLeft, html.EscapeString(title))
+	const ticks = 4
+	for i := 0; i <= ticks; i++ {
+		value := c.maxY * float64(i) / ticks
+		y := c.y(value)
+		fmt.Fprintf(&c.b, `<line x1="%d" x2="%d" y1="%.1f" y2="%.1f" stroke="#e5e5e5"/>`, marginLeft, width-marginRight, y, y)
+		fmt.Fprintf(&c.b, `<text x="%d" y="%.1f" text-anchor="end">%s</text>`, marginLeft-5, y+4, formatValue(value, unit))
+	}
+	return c
+}
+
+func (c *chart) plotWidth() float64 {
+	return float64(c.width - marginLeft - marginRight)
+}
+
+func (c *chart) plotHeight() int {
+	return chartHeight - marginTop - marginBottom
+}
+
+// Left of the slot of the label i
+func (c *chart) x(i int) float64 {
+	return marginLeft + c.plotWidth()*float64(i)/float64(c.count)
+}
+
+func (c *chart) center(i int) float64 {
+	return c.x(i) + c.plotWidth()/float64(c.count)/2
+}
+
+func (c *chart) y(value float64) float64 {
+	if c.maxY == 0 {
+		return float64(marginTop + c.plotHeight())
+	}
+	return float64(marginTop) + float64(c.plotHeight())*(1-value/c.maxY)
+}
+
+// Draws the axes, the labels and the legend, and closes the chart
+func (c *chart) finish(labels []string, horizontal bool) template.HTML {
+	bottom := marginTop + c.plotHeight()
+	fmt.Fprintf(&c.b, `<line x1="%d" x2="%d" y1="%d" y2="%d" stroke="#888"/>`, marginLeft, c.width-marginRight, bottom, bottom)
+	step := 1
+	if len(labels) > maxLabels {
+		step = (len(labels) + maxLabels - 1) / maxLabels
+	}
+	for i := 0; i < len(labels); i += step {
+		x := c.center(i)
+		if horizontal {
+			fmt.Fprintf(&c.b, `<text x="%.1f" y="%d" text-anchor="middle">%s</text>`, x, bottom+15, html.EscapeString(labels[i]))
+		} else {
+			fmt.Fprintf(&c.b, `<text transform="translate(%.1f,%d) rotate(-40)" text-anchor="end">%s</text>`, x, bottom+10, html.EscapeString(shorten(labels[i])))
+		}
+	}
+	x := marginLeft
+	for j, s := range c.series {
+		if len(c.series) == 1 && s.Name == "" {
+			break
+		}
+		fmt.Fprintf(&c.b, `<rect x="%d" y="24" width="10" height="10" fill="%s"/><text x="%d" y="33">%s</text>`, x, colors[j%len(colors)], x+14, html.EscapeString(s.Name))
+		x += 24 + 7*len(s.Name)
+	}
+	c.b.WriteString(`</svg>`)
+	return template.HTML(c.b.String())
+}
+
+// Rounds the highest value of a chart up to 1, 2 or 5 times a power of 10
+func niceCeiling(value float64) float64 {
+	if value <= 0 {
+		return 1
+	}
+	magnitude := math.Pow(10, math.Floor(math.Log10(value)))
+	for _, factor := range []float64{1, 2, 5, 10} {
+		if value <= factor*magnitude {
+			return factor * magnitude
+		}
+	}
+	return 10 * magnitude
+}
+
+func formatValue(value float64, unit string) string {
+	switch unit {
+	case "s":
+		if value < 1 && value != 0 {
+			return strconv.FormatFloat(math.Round(value*1e6)/1000, 'f', -1, 64) + "ms"
+		}
+		return strconv.FormatFloat(math.Round(value*1000)/1000, 'f', -1, 64) + "s"
+	case "%":
+		return strconv.FormatFloat(math.Round(value*100)/100, 'f', -1, 64) + "%"
+	}
+	return strconv.FormatFloat(math.Round(value*100)/100, 'f', -1, 64)
+}
+
+// Longest label written under a bar chart
+const maxLabelSize = 28
+
+func shorten(label string) string {
+	if len(label) > maxLabelSize {
+		return label[:maxLabelSize-3] + "..."
+	}
+	return label
+}
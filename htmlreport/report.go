@@ -0,0 +1,120 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package htmlreport
+
+import (
+	"html/template"
+	"os"
+	"time"
+)
+
+// A name and value shown at the top of the report
+type Field struct {
+	Name  string
+	Value string
+}
+
+type Table struct {
+	Title  string
+	Header []string
+	Rows   [][]string
+}
+
+// A part of the report, like the results of a benchmark or of a create run
+type Section struct {
+	Title  string
+	Tables []*Table
+	Charts []template.HTML
+}
+
+// The results of a run, written to a single HTML file with the charts drawn as
+// inline SVG, so that it opens anywhere without network access
+type Report struct {
+	Title    string
+	Metadata []Field
+	Sections []*Section
+}
+
+func New(title string) *Report {
+	return &Report{Title: title}
+}
+
+func (r *Report) AddField(name string, value string) {
+	r.Metadata = append(r.Metadata, Field{Name: name, Value: value})
+}
+
+func (r *Report) AddSections(sections ...*Section) {
+	r.Sections = append(r.Sections, sections...)
+}
+
+// Writes the report to path, replacing the file if it exists
+func (r *Report) Write(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := page.Execute(f, struct {
+		*Report
+		Generated string
+	}{r, time.Now().Format(time.RFC1123)}); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+var page = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; color: #222; margin: 2em auto; max-width: 1200px; padding: 0 1em; }
+h1 { font-size: 1.6em; border-bottom: 3px solid #2f6db5; padding-bottom: .3em; }
+h2 { font-size: 1.3em; margin-top: 2em; color: #2f6db5; }
+h3 { font-size: 1.05em; margin-top: 1.5em; }
+table { border-collapse: collapse; margin: .5em 0 1.5em; font-size: .85em; }
+th, td { border: 1px solid #ccc; padding: .3em .6em; text-align: right; }
+th { background: #eef3fa; }
+td:first-child, th:first-child { text-align: left; }
+tr:nth-child(even) td { background: #fafafa; }
+.metadata td, .metadata th { text-align: left; }
+.charts { display: flex; flex-wrap: wrap; gap: 1em; }
+.chart { border: 1px solid #ddd; padding: .5em; }
+.chart svg text { font-size: 11px; fill: #444; }
+footer { margin-top: 3em; font-size: .8em; color: #888; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+{{with .Metadata}}<table class="metadata">
+{{range .}}<tr><th>{{.Name}}</th><td>{{.Value}}</td></tr>
+{{end}}</table>{{end}}
+{{range .Sections}}<h2>{{.Title}}</h2>
+{{range .Tables}}{{if .Title}}<h3>{{.Title}}</h3>{{end}}
+<table>
+<tr>{{range .Header}}<th>{{.}}</th>{{end}}</tr>
+{{range .Rows}}<tr>{{range .}}<td>{{.}}</td>{{end}}</tr>
+{{end}}</table>
+{{end}}{{with .Charts}}<div class="charts">
+{{range .}}<div class="chart">{{.}}</div>
+{{end}}</div>{{end}}
+{{end}}<footer>Generated by csbench on {{.Generated}}</footer>
+</body>
+</html>
+`))
@@ -0,0 +1,322 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package htmlreport
+
+import (
+	"csbench/apirunner"
+	"csbench/failure"
+	"csbench/histogram"
+	"csbench/report"
+	"fmt"
+	"html/template"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/montanaflynn/stats"
+)
+
+const (
+	// Most points drawn on a timeline, longer runs are shown in wider intervals
+	maxTimelinePoints = 300
+	// Number of kinds of errors listed for every API in the summary
+	topErrors = 3
+)
+
+// Returns the sections of a benchmark: the summary of every API, the latency by
+// profile and by API, and the errors
+func Benchmark(summaries []*apirunner.Summary, timeline []apirunner.TimelinePoint, errors []*failure.Count) []*Section {
+	overview := &Section{Title: "Benchmark"}
+	summary := &Table{
+		Title:  "Summary",
+		Header: []string{"Profile", "API", "Case", "Page", "PageSize", "Stage", "Calls", "Avg", "Median", "95th percentile", "99th percentile", "Cold start", "Throughput (calls/sec)", "Error rate (%)", "Top errors"},
+	}
+	for _, s := range summaries {
+		page, pageSize := apirunner.PageColumns(s.Page, s.PageSize)
+		summary.Rows = append(summary.Rows, []string{s.Profile, s.Command, s.Case, page, pageSize, s.Stage, strconv.Itoa(s.Calls),
+			seconds(s.AvgTime), seconds(s.Median), seconds(s.Percentile95), seconds(s.Percentile99), apirunner.ColdStartColumn(s.ColdStart),
+			number(s.Throughput), number(s.ErrorRate), s.Errors.Summary(topErrors)})
+	}
+	overview.Tables = append(overview.Tables, summary)
+	if len(timeline) > 0 {
+		overview.Charts = append(overview.Charts, timelineChart("Calls per second", timeline))
+	}
+
+	byProfile := &Section{Title: "Latency by profile"}
+	for _, profile := range groupSummaries(summaries, func(s *apirunner.Summary) string { return s.Profile }) {
+		var labels []string
+		for _, s := range profile.summaries {
+			labels = append(labels, summaryLabel(s, s.Command))
+		}
+		byProfile.Charts = append(byProfile.Charts, BarChart("Profile "+profile.name, "s", labels, percentileSeries(profile.summaries)))
+	}
+
+	byAPI := &Section{Title: "Latency by API"}
+	for _, api := range groupSummaries(summaries, func(s *apirunner.Summary) string { return s.Command }) {
+		var labels []string
+		for _, s := range api.summaries {
+			labels = append(labels, summaryLabel(s, s.Profile))
+		}
+		byAPI.Charts = append(byAPI.Charts,
+			BarChart(api.name+" percentiles", "s", labels, percentileSeries(api.summaries)),
+			histogramChart(api.name+" latency histogram", api.summaries))
+	}
+
+	sections := []*Section{overview, byProfile, byAPI}
+	if len(errors) > 0 {
+		errorSection := &Section{Title: "Errors", Tables: []*Table{errorsTable(errors)}}
+		var labels []string
+		var rates []float64
+		for _, s := range summaries {
+			if s.ErrorRate > 0 {
+				labels = append(labels, summaryLabel(s, s.Command+" "+s.Profile))
+				rates = append(rates, s.ErrorRate)
+			}
+		}
+		errorSection.Charts = append(errorSection.Charts,
+			BarChart("Error rate by API", "%", labels, []Series{{Values: rates}}),
+			categoryChart(errors))
+		sections = append(sections, errorSection)
+	}
+	return sections
+}
+
+// Returns the sections of the tasks of a create, teardown or VM action run, by type of task
+func Tasks(title string, tasks map[string][]*report.TaskResult) []*Section {
+	types := make([]string, 0, len(tasks))
+	for taskType := range tasks {
+		types = append(types, taskType)
+	}
+	sort.Strings(types)
+
+	overview := &Section{Title: title}
+	summary := &Table{
+		Title:  "Summary",
+		Header: []string{"Type", "Count", "Failed", "Min", "Max", "Avg", "Median", "90th percentile", "95th percentile", "99th percentile"},
+	}
+	percentiles := []Series{{Name: "Median"}, {Name: "90th"}, {Name: "95th"}, {Name: "99th"}}
+	var timeline []apirunner.TimelinePoint
+	var start time.Time
+	for _, taskType := range types {
+		for _, task := range tasks[taskType] {
+			if !task.Time.IsZero() && (start.IsZero() || task.Time.Before(start)) {
+				start = task.Time
+			}
+		}
+	}
+	errors := failure.NewCounter()
+	histograms := &Section{Title: title + " latency"}
+	for _, taskType := range types {
+		var durations stats.Float64Data
+		failed := 0
+		h := histogram.New(histogram.DefaultBuckets)
+		for _, task := range tasks[taskType] {
+			durations = append(durations, task.Duration)
+			h.Observe(task.Duration)
+			if !task.Success {
+				failed++
+				errors.Add(task.Error)
+			}
+			if !task.Time.IsZero() {
+				timeline = addToTimeline(timeline, start, task.Time, task.Success)
+			}
+		}
+		min, _ := durations.Min()
+		max, _ := durations.Max()
+		mean, _ := durations.Mean()
+		median, _ := durations.Median()
+		percentile90, _ := durations.Percentile(90)
+		percentile95, _ := durations.Percentile(95)
+		percentile99, _ := durations.Percentile(99)
+		row := []string{taskType, strconv.Itoa(len(durations)), strconv.Itoa(failed), seconds(min), seconds(max), seconds(mean)}
+		for i, value := range []float64{median, percentile90, percentile95, percentile99} {
+			percentiles[i].Values = append(percentiles[i].Values, value)
+			row = append(row, seconds(value))
+		}
+		summary.Rows = append(summary.Rows, row)
+		histograms.Charts = append(histograms.Charts, BarChart(taskType+" latency histogram", "", bucketLabels(h), []Series{{Values: bucketCounts(h)}}))
+	}
+	overview.Tables = append(overview.Tables, summary)
+	overview.Charts = append(overview.Charts, BarChart("Percentiles by type", "s", types, percentiles))
+	if len(timeline) > 0 {
+		overview.Charts = append(overview.Charts, timelineChart("Tasks done per second", timeline))
+	}
+
+	sections := []*Section{overview, histograms}
+	if errors.Total() > 0 {
+		counts := errors.Top(0)
+		sections = append(sections, &Section{
+			Title:  title + " errors",
+			Tables: []*Table{errorsTable(counts)},
+			Charts: []template.HTML{categoryChart(counts)},
+		})
+	}
+	return sections
+}
+
+type summaryGroup struct {
+	name      string
+	summaries []*apirunner.Summary
+}
+
+// Groups the summaries by key, in the order the keys are first seen
+func groupSummaries(summaries []*apirunner.Summary, key func(*apirunner.Summary) string) []*summaryGroup {
+	var groups []*summaryGroup
+	index := make(map[string]*summaryGroup)
+	for _, s := range summaries {
+		name := key(s)
+		group, ok := index[name]
+		if !ok {
+			group = &summaryGroup{name: name}
+			index[name] = group
+			groups = append(groups, group)
+		}
+		group.summaries = append(group.summaries, s)
+	}
+	return groups
+}
+
+// Names the row of a summary in a chart, after name and what tells it apart from the other rows
+func summaryLabel(s *apirunner.Summary, name string) string {
+	parts := []string{name}
+	if s.Case != s.Command {
+		parts = append(parts, s.Case)
+	}
+	if s.Page != 0 {
+		page, pageSize := apirunner.PageColumns(s.Page, s.PageSize)
+		parts = append(parts, fmt.Sprintf("p%s/%s", page, pageSize))
+	}
+	if s.Stage != "-" {
+		parts = append(parts, "stage "+s.Stage)
+	}
+	return strings.Join(parts, " ")
+}
+
+func percentileSeries(summaries []*apirunner.Summary) []Series {
+	series := []Series{{Name: "Median"}, {Name: "90th"}, {Name: "95th"}, {Name: "99th"}}
+	for _, s := range summaries {
+		for i, value := range []float64{s.Median, s.Percentile90, s.Percentile95, s.Percentile99} {
+			series[i].Values = append(series[i].Values, value)
+		}
+	}
+	return series
+}
+
+// Draws the histogram of all the calls of the summaries
+func histogramChart(title string, summaries []*apirunner.Summary) template.HTML {
+	merged := histogram.New(histogram.DefaultBuckets)
+	counts := make([]float64, len(merged.Labels()))
+	for _, s := range summaries {
+		for i, count := range s.Histogram.Counts() {
+			counts[i] += float64(count)
+		}
+	}
+	return BarChart(title, "", bucketLabels(merged), []Series{{Values: counts}})
+}
+
+func bucketLabels(h *histogram.Histogram) []string {
+	labels := h.Labels()
+	for i, label := range labels {
+		if label == "+Inf" {
+			labels[i] = "> " + labels[i-1] + "s"
+		} else {
+			labels[i] = "<= " + label + "s"
+		}
+	}
+	return labels
+}
+
+func bucketCounts(h *histogram.Histogram) []float64 {
+	var counts []float64
+	for _, count := range h.Counts() {
+		counts = append(counts, float64(count))
+	}
+	return counts
+}
+
+// Counts a call made at t in the timeline of the run that started at start
+func addToTimeline(timeline []apirunner.TimelinePoint, start time.Time, t time.Time, success bool) []apirunner.TimelinePoint {
+	second := int(t.Sub(start).Seconds())
+	for len(timeline) <= second {
+		timeline = append(timeline, apirunner.TimelinePoint{Time: start.Add(time.Duration(len(timeline)) * time.Second)})
+	}
+	timeline[second].Calls++
+	if !success {
+		timeline[second].Failed++
+	}
+	return timeline
+}
+
+// Draws the calls and failures per second, averaged over wider intervals for long runs
+func timelineChart(title string, timeline []apirunner.TimelinePoint) template.HTML {
+	step := (len(timeline) + maxTimelinePoints - 1) / maxTimelinePoints
+	var labels []string
+	calls := Series{Name: "Total"}
+	failed := Series{Name: "Failed"}
+	for i := 0; i < len(timeline); i += step {
+		end := i + step
+		if end > len(timeline) {
+			end = len(timeline)
+		}
+		var callCount, failedCount int
+		for _, point := range timeline[i:end] {
+			callCount += point.Calls
+			failedCount += point.Failed
+		}
+		labels = append(labels, timeline[i].Time.Format("15:04:05"))
+		calls.Values = append(calls.Values, float64(callCount)/float64(end-i))
+		failed.Values = append(failed.Values, float64(failedCount)/float64(end-i))
+	}
+	return LineChart(title, "", labels, []Series{calls, failed})
+}
+
+func errorsTable(counts []*failure.Count) *Table {
+	t := &Table{Title: "Errors", Header: []string{"Operation", "Category", "Code", "Message", "Count"}}
+	for _, count := range counts {
+		err := count.Error
+		t.Rows = append(t.Rows, []string{err.Operation, string(err.Category), strconv.Itoa(err.Code), err.Message, strconv.Itoa(count.Count)})
+	}
+	return t
+}
+
+func categoryChart(counts []*failure.Count) template.HTML {
+	totals := make(map[string]float64)
+	var categories []string
+	for _, count := range counts {
+		category := string(count.Error.Category)
+		if _, ok := totals[category]; !ok {
+			categories = append(categories, category)
+		}
+		totals[category] += float64(count.Count)
+	}
+	sort.Strings(categories)
+	var values []float64
+	for _, category := range categories {
+		values = append(values, totals[category])
+	}
+	return BarChart("Errors by category", "", categories, []Series{{Values: values}})
+}
+
+func seconds(value float64) string {
+	return strconv.FormatFloat(value, 'f', 3, 64)
+}
+
+func number(value float64) string {
+	return strconv.FormatFloat(value, 'f', 2, 64)
+}
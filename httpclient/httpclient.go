@@ -0,0 +1,125 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package httpclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// Settings of the HTTP client shared by all the calls to the management server
+type Options struct {
+	// Timeout of a whole call, including reading the response. 0 means no timeout
+	Timeout time.Duration
+	// Reuse connections between calls
+	KeepAlive bool
+	// Idle connections kept open to the management server, the Go defaults if 0
+	MaxIdleConns int
+	// Verify the certificate of the management server
+	VerifySSL bool
+	// PEM file with the CA certificates to verify the management server with,
+	// instead of the ones of the system
+	CACert string
+	// PEM files of the client certificate and its key, for servers asking for mTLS
+	ClientCert string
+	ClientKey  string
+	// URL of the HTTP proxy, the proxy of the HTTP_PROXY and HTTPS_PROXY
+	// environment variables if empty
+	Proxy string
+	// Headers added to every request
+	Headers http.Header
+}
+
+// Creates the HTTP client, failing if a certificate or the proxy URL is invalid
+func New(options Options) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DisableKeepAlives = !options.KeepAlive
+	if options.MaxIdleConns > 0 {
+		transport.MaxIdleConns = options.MaxIdleConns
+		// All the calls go to the same host, so it can use all the idle connections
+		transport.MaxIdleConnsPerHost = options.MaxIdleConns
+	}
+
+	tlsConfig, err := newTLSConfig(options)
+	if err != nil {
+		return nil, err
+	}
+	transport.TLSClientConfig = tlsConfig
+
+	if options.Proxy != "" {
+		proxyURL, err := url.Parse(options.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy %s: %w", options.Proxy, err)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	var roundTripper http.RoundTripper = transport
+	if len(options.Headers) > 0 {
+		roundTripper = &headerTransport{base: transport, headers: options.Headers}
+	}
+	return &http.Client{Transport: roundTripper, Timeout: options.Timeout}, nil
+}
+
+func newTLSConfig(options Options) (*tls.Config, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: !options.VerifySSL}
+
+	if options.CACert != "" {
+		pem, err := os.ReadFile(options.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("error reading the CA certificates %s: %w", options.CACert, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", options.CACert)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if options.ClientCert != "" || options.ClientKey != "" {
+		if options.ClientCert == "" || options.ClientKey == "" {
+			return nil, fmt.Errorf("both the client certificate and the client key are needed for mTLS")
+		}
+		certificate, err := tls.LoadX509KeyPair(options.ClientCert, options.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("error loading the client certificate %s: %w", options.ClientCert, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+	return tlsConfig, nil
+}
+
+// Adds the headers to every request going through it
+type headerTransport struct {
+	base    http.RoundTripper
+	headers http.Header
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// A RoundTripper must not modify the request it was given
+	req = req.Clone(req.Context())
+	for key, values := range t.headers {
+		req.Header[key] = values
+	}
+	return t.base.RoundTrip(req)
+}
@@ -0,0 +1,193 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package loadprofile
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Number of clients running when the first stage starts
+const initialClients = 1
+
+// How often the number of running clients is adjusted
+const tick = 100 * time.Millisecond
+
+// A stage linearly moves the number of concurrent clients from the target of
+// the previous stage to Target over Duration.
+type Stage struct {
+	Duration time.Duration
+	Target   int
+}
+
+/*
+Parses a list of stages in the format duration:target separated by commas.
+The duration is either a number of seconds or a Go duration string.
+
+For example, "5m:40,10m:40,5m:0" ramps from 1 to 40 clients over 5 minutes,
+holds 40 clients for 10 minutes and ramps down to 0 over 5 minutes. A stage with
+a duration of 0 jumps straight to its target.
+*/
+func ParseStages(value string) ([]Stage, error) {
+	var stages []Stage
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		fields := strings.SplitN(part, ":", 2)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid stage %s, expected duration:target", part)
+		}
+		duration, err := parseDuration(strings.TrimSpace(fields[0]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid duration in stage %s: %w", part, err)
+		}
+		target, err := strconv.Atoi(strings.TrimSpace(fields[1]))
+		if err != nil || target < 0 {
+			return nil, fmt.Errorf("invalid target in stage %s", part)
+		}
+		stages = append(stages, Stage{Duration: duration, Target: target})
+	}
+	if len(stages) == 0 {
+		return nil, fmt.Errorf("no stages found in %s", value)
+	}
+	return stages, nil
+}
+
+func parseDuration(value string) (time.Duration, error) {
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second, nil
+	}
+	return time.ParseDuration(value)
+}
+
+// Returns the stages in the same format accepted by ParseStages
+func Format(stages []Stage) string {
+	parts := make([]string, 0, len(stages))
+	for _, stage := range stages {
+		parts = append(parts, fmt.Sprintf("%s:%d", stage.Duration, stage.Target))
+	}
+	return strings.Join(parts, ",")
+}
+
+// Returns the total duration of all the stages
+func TotalDuration(stages []Stage) time.Duration {
+	var total time.Duration
+	for _, stage := range stages {
+		total += stage.Duration
+	}
+	return total
+}
+
+// Returns the highest number of clients reached during the stage
+func PeakClients(stages []Stage, stage int) int {
+	previous := initialClients
+	if stage > 1 {
+		previous = stages[stage-2].Target
+	}
+	if stages[stage-1].Target > previous {
+		return stages[stage-1].Target
+	}
+	return previous
+}
+
+/*
+Returns the stage (starting from 1) and the number of clients that should be
+running after elapsed. finished is true once all the stages are done.
+*/
+func At(stages []Stage, elapsed time.Duration) (stage int, clients int, finished bool) {
+	previous := initialClients
+	for i, s := range stages {
+		if elapsed < s.Duration {
+			progress := float64(elapsed) / float64(s.Duration)
+			clients = previous + int(math.Round(float64(s.Target-previous)*progress))
+			return i + 1, clients, false
+		}
+		elapsed -= s.Duration
+		previous = s.Target
+	}
+	return len(stages), previous, true
+}
+
+/*
+Runs the task in a loop on as many clients as the current stage asks for until
+all the stages are done. Clients are added and removed as the stages ramp up
+and down, a removed client finishes its current task before it stops.
+
+The task gets the stage it is started in, and returns false when there is no
+more work to do, in which case no new clients are started and Run returns once
+the running clients are done.
+*/
+func Run(stages []Stage, task func(stage int) bool) {
+	var wg sync.WaitGroup
+	var exhausted atomic.Bool
+	var running atomic.Int32
+	var stops []chan struct{}
+
+	start := time.Now()
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	for {
+		_, clients, finished := At(stages, time.Since(start))
+		if finished || (exhausted.Load() && running.Load() == 0) {
+			break
+		}
+
+		for len(stops) < clients && !exhausted.Load() {
+			stop := make(chan struct{})
+			stops = append(stops, stop)
+			wg.Add(1)
+			running.Add(1)
+			go func() {
+				defer wg.Done()
+				defer running.Add(-1)
+				for {
+					select {
+					case <-stop:
+						return
+					default:
+					}
+					stage, _, _ := At(stages, time.Since(start))
+					if !task(stage) {
+						exhausted.Store(true)
+						return
+					}
+				}
+			}()
+		}
+
+		for len(stops) > clients {
+			close(stops[len(stops)-1])
+			stops = stops[:len(stops)-1]
+		}
+
+		<-ticker.C
+	}
+
+	for _, stop := range stops {
+		close(stop)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,149 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package loadprofile
+
+import (
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseStages(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    []Stage
+		wantErr bool
+	}{
+		{"5m:40,10m:40,5m:0", []Stage{{5 * time.Minute, 40}, {10 * time.Minute, 40}, {5 * time.Minute, 0}}, false},
+		{"30:10", []Stage{{30 * time.Second, 10}}, false},
+		{" 1m30s : 5 , 0:20 ,", []Stage{{90 * time.Second, 5}, {0, 20}}, false},
+		{"", nil, true},
+		{"5m", nil, true},
+		{"5x:10", nil, true},
+		{"5m:ten", nil, true},
+		{"5m:-1", nil, true},
+	}
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			stages, err := ParseStages(test.value)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("ParseStages(%q) error = %v, want error %t", test.value, err, test.wantErr)
+			}
+			if !reflect.DeepEqual(stages, test.want) {
+				t.Errorf("ParseStages(%q) = %v, want %v", test.value, stages, test.want)
+			}
+		})
+	}
+}
+
+func TestFormat(t *testing.T) {
+	stages := []Stage{{5 * time.Minute, 40}, {30 * time.Second, 0}}
+	formatted := Format(stages)
+	if formatted != "5m0s:40,30s:0" {
+		t.Errorf("Format() = %q, want 5m0s:40,30s:0", formatted)
+	}
+	parsed, err := ParseStages(formatted)
+	if err != nil || !reflect.DeepEqual(parsed, stages) {
+		t.Errorf("ParseStages(Format()) = %v, %v, want %v", parsed, err, stages)
+	}
+	if total := TotalDuration(stages); total != 330*time.Second {
+		t.Errorf("TotalDuration() = %s, want 5m30s", total)
+	}
+}
+
+func TestAt(t *testing.T) {
+	stages := []Stage{{10 * time.Second, 11}, {10 * time.Second, 11}, {0, 20}, {10 * time.Second, 0}}
+	tests := []struct {
+		elapsed  time.Duration
+		stage    int
+		clients  int
+		finished bool
+	}{
+		{0, 1, 1, false},
+		{5 * time.Second, 1, 6, false},
+		{10 * time.Second, 2, 11, false},
+		{19 * time.Second, 2, 11, false},
+		// The stage without duration jumps to its target
+		{20 * time.Second, 4, 20, false},
+		{25 * time.Second, 4, 10, false},
+		{30 * time.Second, 4, 0, true},
+		{time.Hour, 4, 0, true},
+	}
+	for _, test := range tests {
+		t.Run(test.elapsed.String(), func(t *testing.T) {
+			stage, clients, finished := At(stages, test.elapsed)
+			if stage != test.stage || clients != test.clients || finished != test.finished {
+				t.Errorf("At(%s) = %d, %d, %t, want %d, %d, %t", test.elapsed, stage, clients, finished, test.stage, test.clients, test.finished)
+			}
+		})
+	}
+}
+
+func TestPeakClients(t *testing.T) {
+	stages := []Stage{{time.Minute, 40}, {time.Minute, 40}, {time.Minute, 0}}
+	for stage, want := range []int{40, 40, 40} {
+		if peak := PeakClients(stages, stage+1); peak != want {
+			t.Errorf("PeakClients(%d) = %d, want %d", stage+1, peak, want)
+		}
+	}
+	if peak := PeakClients([]Stage{{time.Minute, 0}}, 1); peak != initialClients {
+		t.Errorf("PeakClients() of a ramp down = %d, want %d", peak, initialClients)
+	}
+}
+
+func TestRun(t *testing.T) {
+	stages := []Stage{{0, 4}, {3 * tick, 4}}
+	var running, peak, calls atomic.Int32
+	Run(stages, func(stage int) bool {
+		current := running.Add(1)
+		defer running.Add(-1)
+		for {
+			highest := peak.Load()
+			if current <= highest || peak.CompareAndSwap(highest, current) {
+				break
+			}
+		}
+		calls.Add(1)
+		time.Sleep(tick / 10)
+		return true
+	})
+	if peak.Load() != 4 {
+		t.Errorf("peak clients = %d, want 4", peak.Load())
+	}
+	if running.Load() != 0 {
+		t.Errorf("%d clients still running after Run returned", running.Load())
+	}
+	if calls.Load() == 0 {
+		t.Error("the task was never called")
+	}
+}
+
+func TestRunStopsWhenExhausted(t *testing.T) {
+	var calls atomic.Int32
+	start := time.Now()
+	Run([]Stage{{0, 2}, {time.Minute, 2}}, func(stage int) bool {
+		return calls.Add(1) < 5
+	})
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("Run() took %s after the task ran out of work", elapsed)
+	}
+	if calls.Load() < 5 {
+		t.Errorf("task called %d times, want at least 5", calls.Load())
+	}
+}
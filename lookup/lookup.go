@@ -0,0 +1,277 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package lookup
+
+import (
+	"csbench/domain"
+	"csbench/network"
+	"csbench/vm"
+	"csbench/volume"
+	"fmt"
+	"math/rand"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/apache/cloudstack-go/v2/cloudstack"
+	log "github.com/sirupsen/logrus"
+)
+
+/*
+Matches the placeholders of parameter values, like ${random:vm.id} or
+${each:domain.id}. random picks a value for every call, each runs the case once
+for every value.
+*/
+var placeholderRegex = regexp.MustCompile(`\$\{(random|each):(\w+)\.(\w+)\}`)
+
+const (
+	Random = "random"
+	Each   = "each"
+)
+
+// Fields of every resource that can be used in placeholders
+var resourceFields = map[string][]string{
+	"domain":  {"id", "name", "path"},
+	"account": {"id", "name", "domainid"},
+	"vm":      {"id", "name", "domainid", "account", "zoneid", "state"},
+	"network": {"id", "name", "domainid", "account", "zoneid"},
+	"volume":  {"id", "name", "domainid", "account", "zoneid", "virtualmachineid"},
+}
+
+type placeholder struct {
+	text     string
+	mode     string
+	resource string
+	field    string
+}
+
+func findPlaceholders(value string) []placeholder {
+	var placeholders []placeholder
+	for _, match := range placeholderRegex.FindAllStringSubmatch(value, -1) {
+		placeholders = append(placeholders, placeholder{
+			text:     match[0],
+			mode:     match[1],
+			resource: strings.ToLower(match[2]),
+			field:    strings.ToLower(match[3]),
+		})
+	}
+	return placeholders
+}
+
+// Returns whether any of the values has a placeholder of the mode, or of any mode if empty
+func HasPlaceholders(params map[string]string, mode string) bool {
+	for _, value := range params {
+		for _, p := range findPlaceholders(value) {
+			if mode == "" || p.mode == mode {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+/*
+Resolves placeholders with the resources of the subdomains of the parent domain.
+Every kind of resource is listed once, the first time it is used, with the
+helpers used to create and tear down the environment.
+*/
+type Resolver struct {
+	cs             *cloudstack.CloudStackClient
+	parentDomainId string
+	lock           sync.Mutex
+	// Fields of the resources of every kind, by resource name
+	resources map[string][]map[string]string
+}
+
+func NewResolver(cs *cloudstack.CloudStackClient, parentDomainId string) *Resolver {
+	return &Resolver{
+		cs:             cs,
+		parentDomainId: parentDomainId,
+		resources:      make(map[string][]map[string]string),
+	}
+}
+
+// Returns the value of the field for every resource of the kind
+func (r *Resolver) Values(resource string, field string) ([]string, error) {
+	fields, ok := resourceFields[resource]
+	if !ok {
+		return nil, fmt.Errorf("unknown resource %s, expected one of %s", resource, strings.Join(resourceNames(), ", "))
+	}
+	known := false
+	for _, f := range fields {
+		known = known || f == field
+	}
+	if !known {
+		return nil, fmt.Errorf("unknown field %s of %s, expected one of %s", field, resource, strings.Join(fields, ", "))
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	objects, ok := r.resources[resource]
+	if !ok {
+		objects = r.list(resource)
+		r.resources[resource] = objects
+		log.Infof("Found %d %s resources under the domain %s for parameter placeholders", len(objects), resource, r.parentDomainId)
+	}
+
+	var values []string
+	for _, object := range objects {
+		if value := object[field]; value != "" {
+			values = append(values, value)
+		}
+	}
+	if len(values) == 0 {
+		return nil, fmt.Errorf("no %s with a %s found under the domain %s", resource, field, r.parentDomainId)
+	}
+	return values, nil
+}
+
+/*
+Returns the parameters for every combination of the values of the each
+placeholders in them. The resources used by random placeholders are listed
+as well, so that errors are reported before the case is run.
+*/
+func (r *Resolver) Expand(params map[string]string) ([]map[string]string, error) {
+	variants := []map[string]string{copyParams(params)}
+	expanded := make(map[string]bool)
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		for _, p := range findPlaceholders(params[key]) {
+			values, err := r.Values(p.resource, p.field)
+			if err != nil {
+				return nil, fmt.Errorf("%s in the parameter %s: %w", p.text, key, err)
+			}
+			if p.mode != Each || expanded[p.text] {
+				continue
+			}
+			// The same placeholder used in several parameters gets the same value
+			expanded[p.text] = true
+			var next []map[string]string
+			for _, variant := range variants {
+				for _, value := range values {
+					resolved := copyParams(variant)
+					for k, v := range resolved {
+						resolved[k] = strings.ReplaceAll(v, p.text, value)
+					}
+					next = append(next, resolved)
+				}
+			}
+			variants = next
+		}
+	}
+	return variants, nil
+}
+
+// Returns a copy of the parameters with the random placeholders replaced by a random value
+func (r *Resolver) ResolveRandom(params url.Values) url.Values {
+	resolved := make(url.Values, len(params))
+	for key, values := range params {
+		resolved[key] = make([]string, len(values))
+		for i, value := range values {
+			resolved[key][i] = placeholderRegex.ReplaceAllStringFunc(value, func(text string) string {
+				p := findPlaceholders(text)[0]
+				if p.mode != Random {
+					return text
+				}
+				candidates, err := r.Values(p.resource, p.field)
+				if err != nil {
+					log.Warnf("Failed to resolve %s: %s", text, err)
+					return text
+				}
+				return candidates[rand.Intn(len(candidates))]
+			})
+		}
+	}
+	return resolved
+}
+
+// Lists the resources of the kind in the subdomains of the parent domain
+func (r *Resolver) list(resource string) []map[string]string {
+	var objects []map[string]string
+	domains := domain.ListSubDomains(r.cs, r.parentDomainId)
+	if resource == "domain" {
+		for _, dmn := range domains {
+			objects = append(objects, map[string]string{"id": dmn.Id, "name": dmn.Name, "path": dmn.Path})
+		}
+		return objects
+	}
+
+	for _, dmn := range domains {
+		switch resource {
+		case "account":
+			for _, account := range domain.ListAccounts(r.cs, dmn.Id) {
+				objects = append(objects, map[string]string{"id": account.Id, "name": account.Name, "domainid": account.Domainid})
+			}
+		case "vm":
+			vms, err := vm.ListVMs(r.cs, dmn.Id)
+			if err != nil {
+				log.Warn("Error listing VMs: ", err)
+				continue
+			}
+			for _, v := range vms {
+				objects = append(objects, map[string]string{"id": v.Id, "name": v.Name, "domainid": v.Domainid,
+					"account": v.Account, "zoneid": v.Zoneid, "state": v.State})
+			}
+		case "network":
+			networks, err := network.ListNetworks(r.cs, dmn.Id)
+			if err != nil {
+				log.Warn("Error listing networks: ", err)
+				continue
+			}
+			for _, n := range networks {
+				objects = append(objects, map[string]string{"id": n.Id, "name": n.Name, "domainid": n.Domainid,
+					"account": n.Account, "zoneid": n.Zoneid})
+			}
+		case "volume":
+			volumes, err := volume.ListVolumes(r.cs, dmn.Id)
+			if err != nil {
+				log.Warn("Error listing volumes: ", err)
+				continue
+			}
+			for _, v := range volumes {
+				objects = append(objects, map[string]string{"id": v.Id, "name": v.Name, "domainid": v.Domainid,
+					"account": v.Account, "zoneid": v.Zoneid, "virtualmachineid": v.Virtualmachineid})
+			}
+		}
+	}
+	return objects
+}
+
+func resourceNames() []string {
+	names := make([]string, 0, len(resourceFields))
+	for name := range resourceFields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func copyParams(params map[string]string) map[string]string {
+	copied := make(map[string]string, len(params))
+	for key, value := range params {
+		copied[key] = value
+	}
+	return copied
+}
@@ -0,0 +1,244 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package metadata
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/apache/cloudstack-go/v2/cloudstack"
+	log "github.com/sirupsen/logrus"
+)
+
+// Version of csbench, set at build time with -ldflags "-X csbench/metadata.Version=1.0.0".
+// The commit csbench was built from is used if not set.
+var Version = ""
+
+// Keys of the config file whose values are left out of the config hash
+var secretKeys = map[string]bool{"apikey": true, "secretkey": true, "password": true, "influxtoken": true}
+
+// Resources counted in the inventory, by the list API counting them
+var inventoryAPIs = map[string]string{
+	"domains":  "listDomains",
+	"accounts": "listAccounts",
+	"vms":      "listVirtualMachines",
+	"volumes":  "listVolumes",
+	"networks": "listNetworks",
+}
+
+type ManagementServer struct {
+	Name      string `json:"name"`
+	Version   string `json:"version"`
+	State     string `json:"state"`
+	IPAddress string `json:"ipaddress"`
+}
+
+// The settings of a run and the environment it ran against, saved next to its results
+type Metadata struct {
+	// Identifies the run in the Run column of the reports and names its results
+	// directory, like 20240115-093012-7f3a
+	Run            string    `json:"run"`
+	Modes          []string  `json:"modes"`
+	CsbenchVersion string    `json:"csbenchversion"`
+	CommandLine    []string  `json:"commandline"`
+	Started        time.Time `json:"started"`
+	Finished       time.Time `json:"finished"`
+	DBProfile      int       `json:"dbprofile"`
+	ConfigFile     string    `json:"configfile"`
+	// SHA-256 of the settings of the config file, without comments and secrets
+	ConfigHash        string                 `json:"confighash"`
+	URL               string                 `json:"url"`
+	CloudStackVersion string                 `json:"cloudstackversion"`
+	Capabilities      map[string]interface{} `json:"capabilities,omitempty"`
+	ManagementServers []*ManagementServer    `json:"managementservers,omitempty"`
+	// Number of domains, accounts, vms, volumes and networks when the run started
+	Inventory map[string]int `json:"inventory,omitempty"`
+}
+
+func New(modes []string, commandLine []string, configFile string, url string, dbProfile int) *Metadata {
+	started := time.Now()
+	m := &Metadata{
+		Run:            newRunID(started),
+		Modes:          modes,
+		CsbenchVersion: BuildVersion(),
+		CommandLine:    commandLine,
+		Started:        started,
+		DBProfile:      dbProfile,
+		ConfigFile:     configFile,
+		URL:            url,
+	}
+	hash, err := ConfigHash(configFile)
+	if err != nil {
+		log.Warnf("Failed to hash the config file %s: %s", configFile, err)
+	}
+	m.ConfigHash = hash
+	return m
+}
+
+// Returns an id made of the UTC start time of the run and a random suffix, so
+// that runs started in the same second get their own results directory
+func newRunID(started time.Time) string {
+	suffix := make([]byte, 2)
+	if _, err := rand.Read(suffix); err != nil {
+		return started.UTC().Format("20060102-150405.000")
+	}
+	return started.UTC().Format("20060102-150405") + "-" + hex.EncodeToString(suffix)
+}
+
+// Returns Version, or the commit csbench was built from
+func BuildVersion() string {
+	if Version != "" {
+		return Version
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	version := info.Main.Version
+	var revision, modified string
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			revision = setting.Value
+		case "vcs.modified":
+			if setting.Value == "true" {
+				modified = "-dirty"
+			}
+		}
+	}
+	if revision != "" {
+		if len(revision) > 12 {
+			revision = revision[:12]
+		}
+		return revision + modified
+	}
+	return version
+}
+
+/*
+Returns the SHA-256 of the settings of the config file, so that runs made with
+the same settings can be told apart from the others. Comments, blank lines and
+the values of the credentials are left out, so that the hash does not change
+with the keys of the users and can be shared.
+*/
+func ConfigHash(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if parts := strings.SplitN(line, "=", 2); len(parts) == 2 {
+			key := strings.ToLower(strings.TrimSpace(parts[0]))
+			value := strings.TrimSpace(parts[1])
+			if secretKeys[key] {
+				value = ""
+			}
+			line = key + "=" + value
+		}
+		fmt.Fprintln(hash, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+/*
+Collects the version and capabilities of CloudStack, its management servers and
+the number of resources of the environment, as seen by the admin client cs. What
+cannot be collected is logged and left out.
+*/
+func (m *Metadata) Collect(cs *cloudstack.CloudStackClient) {
+	custom, ok := cs.Custom.(*cloudstack.CustomService)
+	if !ok {
+		log.Warn("Failed to collect the metadata of the environment, the client cannot send custom requests")
+		return
+	}
+
+	var capabilities struct {
+		Capability map[string]interface{} `json:"capability"`
+	}
+	if err := custom.CustomRequest("listCapabilities", &cloudstack.CustomServiceParams{}, &capabilities); err != nil {
+		log.Warnf("Failed to list the capabilities of the management server: %s", err)
+	} else {
+		m.Capabilities = capabilities.Capability
+		if version, ok := m.Capabilities["cloudstackversion"].(string); ok {
+			m.CloudStackVersion = version
+		}
+	}
+
+	var servers struct {
+		ManagementServers []*ManagementServer `json:"managementserver"`
+	}
+	if err := custom.CustomRequest("listManagementServers", &cloudstack.CustomServiceParams{}, &servers); err != nil {
+		log.Warnf("Failed to list the management servers: %s", err)
+	} else {
+		m.ManagementServers = servers.ManagementServers
+	}
+
+	m.Inventory = make(map[string]int)
+	for resource, api := range inventoryAPIs {
+		params := &cloudstack.CustomServiceParams{}
+		params.SetParam("listall", "true")
+		params.SetParam("page", 1)
+		params.SetParam("pagesize", 1)
+		var count struct {
+			Count int `json:"count"`
+		}
+		if err := custom.CustomRequest(api, params, &count); err != nil {
+			log.Warnf("Failed to count the %s of the environment: %s", resource, err)
+			continue
+		}
+		m.Inventory[resource] = count.Count
+	}
+}
+
+// Records the end of the run, can be called again if the run goes on
+func (m *Metadata) Finish() {
+	m.Finished = time.Now()
+}
+
+// Formats the inventory on one line, like "2 accounts, 5 domains"
+func (m *Metadata) InventorySummary() string {
+	resources := make([]string, 0, len(m.Inventory))
+	for resource := range m.Inventory {
+		resources = append(resources, resource)
+	}
+	sort.Strings(resources)
+	var parts []string
+	for _, resource := range resources {
+		parts = append(parts, fmt.Sprintf("%d %s", m.Inventory[resource], resource))
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,106 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Writes the points in the Graphite plaintext protocol, with tags
+type graphiteWriter struct {
+	address string
+	conn    net.Conn
+}
+
+/*
+Creates a sink sending the points to the plaintext listener of Graphite, like
+localhost:2003. Every field is sent as a tagged series named after the point
+and the field, like csbench_requests.p95;command=listVirtualMachines;profile=admin,
+which needs Graphite 1.1 or later.
+*/
+func NewGraphiteSink(address string, tags map[string]string, interval time.Duration) (*Sink, error) {
+	w := &graphiteWriter{address: address}
+	if err := w.connect(); err != nil {
+		return nil, err
+	}
+	return newSink("Graphite "+address, w, tags, interval), nil
+}
+
+func (w *graphiteWriter) connect() error {
+	conn, err := net.DialTimeout("tcp", w.address, 10*time.Second)
+	if err != nil {
+		return err
+	}
+	w.conn = conn
+	return nil
+}
+
+func (w *graphiteWriter) write(points []*Point) error {
+	if w.conn == nil {
+		if err := w.connect(); err != nil {
+			return err
+		}
+	}
+	buffer := bufio.NewWriter(w.conn)
+	for _, point := range points {
+		for _, line := range graphiteLines(point) {
+			buffer.WriteString(line)
+			buffer.WriteByte('\n')
+		}
+	}
+	w.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	if err := buffer.Flush(); err != nil {
+		// Connect again for the next points, Graphite may have been restarted
+		w.conn.Close()
+		w.conn = nil
+		return err
+	}
+	return nil
+}
+
+func (w *graphiteWriter) close() error {
+	if w.conn == nil {
+		return nil
+	}
+	return w.conn.Close()
+}
+
+// Characters not allowed in the names and tags of the series
+var graphiteEscaper = strings.NewReplacer(" ", "_", ";", "_", "~", "_", "=", "_", "!", "_", "^", "_")
+
+// Returns a line name;tag=value value timestamp per field, the timestamp in seconds
+func graphiteLines(point *Point) []string {
+	var tags strings.Builder
+	for _, name := range point.tagNames() {
+		if point.Tags[name] == "" {
+			continue
+		}
+		fmt.Fprintf(&tags, ";%s=%s", graphiteEscaper.Replace(name), graphiteEscaper.Replace(point.Tags[name]))
+	}
+	var lines []string
+	for _, name := range point.fieldNames() {
+		lines = append(lines, fmt.Sprintf("%s.%s%s %s %d", graphiteEscaper.Replace(point.Name), graphiteEscaper.Replace(name), tags.String(),
+			strconv.FormatFloat(point.Fields[name], 'f', -1, 64), point.Time.Unix()))
+	}
+	return lines
+}
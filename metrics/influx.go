@@ -0,0 +1,101 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Writes the points in the InfluxDB line protocol to its HTTP write API
+type influxWriter struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+/*
+Creates a sink sending the points to the write API of InfluxDB, like
+http://localhost:8086/write?db=csbench for InfluxDB 1.x or
+http://localhost:8086/api/v2/write?org=perf&bucket=csbench for 2.x. The token,
+if set, is sent in the Authorization header.
+*/
+func NewInfluxSink(url string, token string, tags map[string]string, interval time.Duration) *Sink {
+	w := &influxWriter{url: url, token: token, client: &http.Client{Timeout: 10 * time.Second}}
+	return newSink("InfluxDB "+url, w, tags, interval)
+}
+
+func (w *influxWriter) write(points []*Point) error {
+	var body bytes.Buffer
+	for _, point := range points {
+		body.WriteString(influxLine(point))
+		body.WriteByte('\n')
+	}
+	req, err := http.NewRequest(http.MethodPost, w.url, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if w.token != "" {
+		req.Header.Set("Authorization", "Token "+w.token)
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
+
+func (w *influxWriter) close() error {
+	return nil
+}
+
+// Characters escaped in the names and tags of the line protocol
+var influxEscaper = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+
+// Returns the point as measurement,tag=value field=value timestamp, the timestamp in nanoseconds
+func influxLine(point *Point) string {
+	var line strings.Builder
+	line.WriteString(influxEscaper.Replace(point.Name))
+	for _, name := range point.tagNames() {
+		if point.Tags[name] == "" {
+			// Empty tag values are not allowed
+			continue
+		}
+		fmt.Fprintf(&line, ",%s=%s", influxEscaper.Replace(name), influxEscaper.Replace(point.Tags[name]))
+	}
+	for i, name := range point.fieldNames() {
+		separator := ","
+		if i == 0 {
+			separator = " "
+		}
+		fmt.Fprintf(&line, "%s%s=%s", separator, influxEscaper.Replace(name), strconv.FormatFloat(point.Fields[name], 'f', -1, 64))
+	}
+	fmt.Fprintf(&line, " %d", point.Time.UnixNano())
+	return line.String()
+}
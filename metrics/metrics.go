@@ -0,0 +1,237 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package metrics
+
+import (
+	"csbench/histogram"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+/*
+Live metrics of the run in the Prometheus text format, served on /metrics by
+Serve. Nothing is collected until Serve is called, the API calls are also sent
+to the sinks added with AddSink.
+
+  - csbench_requests_total{command,profile,outcome}: API calls, the outcome
+    being success or the category of the error
+  - csbench_request_duration_seconds{command,profile}: latency histogram of
+    the API calls, including the time taken by the jobs of async commands
+  - csbench_requests_in_flight{profile}: API calls waiting for their response
+  - csbench_tasks_planned{task}: resources to create, delete or act on by
+    -create, -teardown and -vmaction
+  - csbench_tasks_completed_total{task,outcome}: tasks done, the outcome being
+    success or failure
+*/
+
+type requestKey struct {
+	command string
+	profile string
+	outcome string
+}
+
+type latencyKey struct {
+	command string
+	profile string
+}
+
+type taskKey struct {
+	task    string
+	outcome string
+}
+
+var (
+	lock      sync.Mutex
+	serving   bool
+	sinks     []*Sink
+	requests  = make(map[requestKey]uint64)
+	latencies = make(map[latencyKey]*histogram.Histogram)
+	inFlight  = make(map[string]int)
+	planned   = make(map[string]int)
+	completed = make(map[taskKey]uint64)
+)
+
+// Starts serving the metrics on the address, like :9100, in the background
+func Serve(address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		Write(w)
+	})
+	go func() {
+		if err := http.Serve(listener, mux); err != nil {
+			log.Warnf("Stopped serving the metrics on %s: %s", address, err)
+		}
+	}()
+
+	lock.Lock()
+	defer lock.Unlock()
+	serving = true
+	log.Infof("Serving the metrics on http://%s/metrics", listener.Addr())
+	return nil
+}
+
+// Sends the API calls counted from now on to the sink
+func AddSink(sink *Sink) {
+	lock.Lock()
+	defer lock.Unlock()
+	sinks = append(sinks, sink)
+}
+
+// Sends the points left to the sinks and closes them
+func CloseSinks() {
+	lock.Lock()
+	closing := sinks
+	sinks = nil
+	lock.Unlock()
+	for _, sink := range closing {
+		if err := sink.Close(); err != nil {
+			log.Warnf("Failed to close %s: %s", sink.name, err)
+		}
+	}
+}
+
+// Returns whether the API calls are counted, by the metrics served or by a sink
+func Enabled() bool {
+	lock.Lock()
+	defer lock.Unlock()
+	return serving || len(sinks) > 0
+}
+
+// Counts an API call that took duration seconds
+func ObserveRequest(command string, profile string, outcome string, duration float64) {
+	lock.Lock()
+	defer lock.Unlock()
+	for _, sink := range sinks {
+		sink.observe(command, profile, outcome, duration)
+	}
+	if !serving {
+		return
+	}
+	requests[requestKey{command, profile, outcome}]++
+	key := latencyKey{command, profile}
+	if latencies[key] == nil {
+		latencies[key] = histogram.New(histogram.DefaultBuckets)
+	}
+	latencies[key].Observe(duration)
+}
+
+// Counts an API call of the profile as in flight, until the returned function is called
+func StartRequest(profile string) func() {
+	lock.Lock()
+	defer lock.Unlock()
+	if !serving {
+		return func() {}
+	}
+	inFlight[profile]++
+	return func() {
+		lock.Lock()
+		defer lock.Unlock()
+		inFlight[profile]--
+	}
+}
+
+// Sets the number of tasks to run, like the number of VMs to deploy
+func SetPlanned(task string, count int) {
+	lock.Lock()
+	defer lock.Unlock()
+	if serving {
+		planned[task] = count
+	}
+}
+
+func TaskDone(task string, success bool) {
+	lock.Lock()
+	defer lock.Unlock()
+	if !serving {
+		return
+	}
+	outcome := "success"
+	if !success {
+		outcome = "failure"
+	}
+	completed[taskKey{task, outcome}]++
+}
+
+// Writes all the metrics in the Prometheus text format
+func Write(w io.Writer) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	var series [][]string
+	for key, count := range requests {
+		series = append(series, []string{fmt.Sprintf("csbench_requests_total{command=%q,profile=%q,outcome=%q} %d", key.command, key.profile, key.outcome, count)})
+	}
+	writeMetric(w, "csbench_requests_total", "counter", "API calls by command, profile and outcome.", series)
+
+	series = nil
+	for key, h := range latencies {
+		labels := fmt.Sprintf("command=%q,profile=%q", key.command, key.profile)
+		bounds := h.Labels()
+		var lines []string
+		for i, count := range h.Cumulative() {
+			lines = append(lines, fmt.Sprintf("csbench_request_duration_seconds_bucket{%s,le=%q} %d", labels, bounds[i], count))
+		}
+		lines = append(lines,
+			fmt.Sprintf("csbench_request_duration_seconds_sum{%s} %g", labels, h.Sum()),
+			fmt.Sprintf("csbench_request_duration_seconds_count{%s} %d", labels, h.Count()))
+		series = append(series, lines)
+	}
+	writeMetric(w, "csbench_request_duration_seconds", "histogram", "Latency of the API calls in seconds.", series)
+
+	series = nil
+	for profile, count := range inFlight {
+		series = append(series, []string{fmt.Sprintf("csbench_requests_in_flight{profile=%q} %d", profile, count)})
+	}
+	writeMetric(w, "csbench_requests_in_flight", "gauge", "API calls waiting for their response.", series)
+
+	series = nil
+	for task, count := range planned {
+		series = append(series, []string{fmt.Sprintf("csbench_tasks_planned{task=%q} %d", task, count)})
+	}
+	writeMetric(w, "csbench_tasks_planned", "gauge", "Tasks to run by create, teardown and vmaction.", series)
+
+	series = nil
+	for key, count := range completed {
+		series = append(series, []string{fmt.Sprintf("csbench_tasks_completed_total{task=%q,outcome=%q} %d", key.task, key.outcome, count)})
+	}
+	writeMetric(w, "csbench_tasks_completed_total", "counter", "Tasks done by create, teardown and vmaction, by outcome.", series)
+}
+
+// Writes the lines of every series of the metric, sorted by their labels so that the output is stable
+func writeMetric(w io.Writer, name string, metricType string, help string, series [][]string) {
+	sort.Slice(series, func(i, j int) bool {
+		return series[i][0] < series[j][0]
+	})
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType)
+	for _, lines := range series {
+		for _, line := range lines {
+			fmt.Fprintln(w, line)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package metrics
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/montanaflynn/stats"
+	log "github.com/sirupsen/logrus"
+)
+
+// Names of the measurements sent to the time series databases
+const (
+	// One per API call, with its duration
+	requestMeasurement = "csbench_request"
+	// One per command and profile every interval, with the count, errors and latencies of the calls
+	intervalMeasurement = "csbench_requests"
+)
+
+// How often the points of the API calls are sent when sending a point per call
+const requestFlushInterval = time.Second
+
+// A measurement sent to a time series database
+type Point struct {
+	Name   string
+	Tags   map[string]string
+	Fields map[string]float64
+	Time   time.Time
+}
+
+// Returns the names of the tags, sorted so that the points are written the same way every time
+func (p *Point) tagNames() []string {
+	names := make([]string, 0, len(p.Tags))
+	for name := range p.Tags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (p *Point) fieldNames() []string {
+	names := make([]string, 0, len(p.Fields))
+	for name := range p.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Writes points in the protocol of a time series database
+type writer interface {
+	write(points []*Point) error
+	close() error
+}
+
+// Calls of a command by a profile during an interval
+type intervalStats struct {
+	failures  int
+	latencies stats.Float64Data
+}
+
+/*
+Sends the API calls counted in the metrics to a time series database, in the
+background. With an interval, a point per command and profile is sent every
+interval with the count, errors, average, max and 95th percentile latency of
+its calls. Without one, a point is sent for every call, in batches. The tags
+are added to all the points.
+*/
+type Sink struct {
+	name     string
+	writer   writer
+	tags     map[string]string
+	interval time.Duration
+
+	lock      sync.Mutex
+	points    []*Point
+	intervals map[requestKey]*intervalStats
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+func newSink(name string, w writer, tags map[string]string, interval time.Duration) *Sink {
+	s := &Sink{
+		name:      name,
+		writer:    w,
+		tags:      tags,
+		interval:  interval,
+		intervals: make(map[requestKey]*intervalStats),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+func (s *Sink) run() {
+	defer close(s.done)
+	flushInterval := s.interval
+	if flushInterval <= 0 {
+		flushInterval = requestFlushInterval
+	}
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.flush()
+		case <-s.stop:
+			s.flush()
+			return
+		}
+	}
+}
+
+func (s *Sink) observe(command string, profile string, outcome string, duration float64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.interval <= 0 {
+		s.points = append(s.points, &Point{
+			Name:   requestMeasurement,
+			Tags:   s.pointTags(map[string]string{"command": command, "profile": profile, "outcome": outcome}),
+			Fields: map[string]float64{"duration": duration},
+			Time:   time.Now(),
+		})
+		return
+	}
+
+	// The outcome is not a tag of the interval points, the failures are counted instead
+	key := requestKey{command: command, profile: profile}
+	interval := s.intervals[key]
+	if interval == nil {
+		interval = &intervalStats{}
+		s.intervals[key] = interval
+	}
+	interval.latencies = append(interval.latencies, duration)
+	if outcome != "success" {
+		interval.failures++
+	}
+}
+
+// Returns the tags of the sink with the tags of the point, which take precedence
+// so that a sinktag named like command cannot mislabel the calls
+func (s *Sink) pointTags(tags map[string]string) map[string]string {
+	merged := make(map[string]string, len(s.tags)+len(tags))
+	for name, value := range s.tags {
+		merged[name] = value
+	}
+	for name, value := range tags {
+		merged[name] = value
+	}
+	return merged
+}
+
+// Sends the points of the calls observed since the last flush
+func (s *Sink) flush() {
+	s.lock.Lock()
+	points := s.points
+	s.points = nil
+	now := time.Now()
+	for key, interval := range s.intervals {
+		avg, _ := interval.latencies.Mean()
+		max, _ := interval.latencies.Max()
+		percentile95, _ := interval.latencies.Percentile(95)
+		points = append(points, &Point{
+			Name: intervalMeasurement,
+			Tags: s.pointTags(map[string]string{"command": key.command, "profile": key.profile}),
+			Fields: map[string]float64{
+				"count":  float64(len(interval.latencies)),
+				"errors": float64(interval.failures),
+				"avg":    avg,
+				"max":    max,
+				"p95":    percentile95,
+			},
+			Time: now,
+		})
+	}
+	s.intervals = make(map[requestKey]*intervalStats)
+	s.lock.Unlock()
+
+	if len(points) == 0 {
+		return
+	}
+	if err := s.writer.write(points); err != nil {
+		log.Warnf("Failed to send %d points to %s: %s", len(points), s.name, err)
+	}
+}
+
+// Sends the points left and closes the connection
+func (s *Sink) Close() error {
+	close(s.stop)
+	<-s.done
+	return s.writer.close()
+}
@@ -0,0 +1,285 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+var pointTime = time.Unix(1704881573, 500)
+
+func TestInfluxLine(t *testing.T) {
+	tests := []struct {
+		name  string
+		point *Point
+		want  string
+	}{
+		{"request", &Point{Name: requestMeasurement, Tags: map[string]string{"profile": "admin", "command": "listZones", "outcome": "success"},
+			Fields: map[string]float64{"duration": 0.0125}, Time: pointTime},
+			"csbench_request,command=listZones,outcome=success,profile=admin duration=0.0125 1704881573000000500"},
+		{"interval", &Point{Name: intervalMeasurement, Tags: map[string]string{"command": "listZones", "host": "10.0.3.5"},
+			Fields: map[string]float64{"p95": 0.2, "count": 120, "avg": 0.05}, Time: pointTime},
+			"csbench_requests,command=listZones,host=10.0.3.5 avg=0.05,count=120,p95=0.2 1704881573000000500"},
+		{"escaped", &Point{Name: "csbench request", Tags: map[string]string{"run": "a b,c=d"},
+			Fields: map[string]float64{"duration": 1}, Time: pointTime},
+			`csbench\ request,run=a\ b\,c\=d duration=1 1704881573000000500`},
+		{"empty tag", &Point{Name: requestMeasurement, Tags: map[string]string{"run": "", "command": "listZones"},
+			Fields: map[string]float64{"duration": 1}, Time: pointTime},
+			"csbench_request,command=listZones duration=1 1704881573000000500"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := influxLine(test.point); got != test.want {
+				t.Errorf("influxLine() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestGraphiteLines(t *testing.T) {
+	tests := []struct {
+		name  string
+		point *Point
+		want  []string
+	}{
+		{"request", &Point{Name: requestMeasurement, Tags: map[string]string{"profile": "admin", "command": "listZones"},
+			Fields: map[string]float64{"duration": 0.0125}, Time: pointTime},
+			[]string{"csbench_request.duration;command=listZones;profile=admin 0.0125 1704881573"}},
+		{"interval", &Point{Name: intervalMeasurement, Tags: map[string]string{"command": "listZones"},
+			Fields: map[string]float64{"errors": 1, "count": 2}, Time: pointTime},
+			[]string{"csbench_requests.count;command=listZones 2 1704881573", "csbench_requests.errors;command=listZones 1 1704881573"}},
+		{"escaped", &Point{Name: requestMeasurement, Tags: map[string]string{"run": "a b;c=d", "empty": ""},
+			Fields: map[string]float64{"duration": 1}, Time: pointTime},
+			[]string{"csbench_request.duration;run=a_b_c_d 1 1704881573"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := graphiteLines(test.point); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("graphiteLines() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestStatsDLines(t *testing.T) {
+	tests := []struct {
+		name  string
+		point *Point
+		want  []string
+	}{
+		{"request as a timing", &Point{Name: requestMeasurement, Tags: map[string]string{"profile": "admin", "command": "listZones"},
+			Fields: map[string]float64{"duration": 0.0125}, Time: pointTime},
+			[]string{"csbench_request.duration:12.500|ms|#command:listZones,profile:admin"}},
+		{"interval as gauges", &Point{Name: intervalMeasurement, Tags: map[string]string{"command": "listZones"},
+			Fields: map[string]float64{"p95": 0.2, "count": 2}, Time: pointTime},
+			[]string{"csbench_requests.count:2|g|#command:listZones", "csbench_requests.p95:0.2|g|#command:listZones"}},
+		{"without tags", &Point{Name: intervalMeasurement, Fields: map[string]float64{"count": 2}, Time: pointTime},
+			[]string{"csbench_requests.count:2|g"}},
+		{"escaped", &Point{Name: requestMeasurement, Tags: map[string]string{"run": "a:b|c,d"},
+			Fields: map[string]float64{"duration": 1}, Time: pointTime},
+			[]string{"csbench_request.duration:1000.000|ms|#run:a_b_c_d"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := statsDLines(test.point); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("statsDLines() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestPointTags(t *testing.T) {
+	tests := []struct {
+		name     string
+		sinkTags map[string]string
+		want     map[string]string
+	}{
+		{"without sink tags", nil, map[string]string{"command": "listZones", "profile": "admin"}},
+		{"with sink tags", map[string]string{"run": "r1", "host": "ms1"},
+			map[string]string{"command": "listZones", "profile": "admin", "run": "r1", "host": "ms1"}},
+		{"sink tag named like a point tag", map[string]string{"command": "nightly", "run": "r1"},
+			map[string]string{"command": "listZones", "profile": "admin", "run": "r1"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sink := &Sink{tags: test.sinkTags}
+			got := sink.pointTags(map[string]string{"command": "listZones", "profile": "admin"})
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("pointTags() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+// Observes two calls of listZones, one of them failed, and closes the sink to send them
+func observeAndClose(t *testing.T, sink *Sink) {
+	t.Helper()
+	sink.observe("listZones", "admin", "success", 0.2)
+	sink.observe("listZones", "admin", "failure", 0.2)
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Returns the lines without their timestamp, the last field, sorted
+func withoutTimestamps(lines []string) []string {
+	var result []string
+	for _, line := range lines {
+		if line == "" {
+			continue
+		}
+		result = append(result, line[:strings.LastIndex(line, " ")])
+	}
+	sort.Strings(result)
+	return result
+}
+
+func TestInfluxSink(t *testing.T) {
+	received := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Token secret" {
+			t.Errorf("Authorization header %q, want the token", r.Header.Get("Authorization"))
+		}
+		body, _ := io.ReadAll(r.Body)
+		received <- string(body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	observeAndClose(t, NewInfluxSink(server.URL+"/write?db=csbench", "secret", map[string]string{"run": "r1"}, time.Hour))
+	got := withoutTimestamps(strings.Split(<-received, "\n"))
+	want := []string{"csbench_requests,command=listZones,profile=admin,run=r1 avg=0.2,count=2,errors=1,max=0.2,p95=0.2"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("InfluxDB received %q, want %q", got, want)
+	}
+}
+
+func TestGraphiteSink(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	received := make(chan []string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			received <- nil
+			return
+		}
+		defer conn.Close()
+		var lines []string
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			lines = append(lines, scanner.Text())
+		}
+		received <- lines
+	}()
+
+	sink, err := NewGraphiteSink(listener.Addr().String(), map[string]string{"run": "r1"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	observeAndClose(t, sink)
+	got := withoutTimestamps(<-received)
+	want := []string{
+		"csbench_request.duration;command=listZones;outcome=failure;profile=admin;run=r1 0.2",
+		"csbench_request.duration;command=listZones;outcome=success;profile=admin;run=r1 0.2",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Graphite received %q, want %q", got, want)
+	}
+}
+
+func TestStatsDSink(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	sink, err := NewStatsDSink(conn.LocalAddr().String(), map[string]string{"run": "r1"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	observeAndClose(t, sink)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	packet := make([]byte, maxStatsDPacketSize)
+	n, _, err := conn.ReadFrom(packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := strings.Split(string(packet[:n]), "\n")
+	sort.Strings(got)
+	tags := "|g|#command:listZones,profile:admin,run:r1"
+	want := []string{
+		"csbench_requests.avg:0.2" + tags,
+		"csbench_requests.count:2" + tags,
+		"csbench_requests.errors:1" + tags,
+		"csbench_requests.max:0.2" + tags,
+		"csbench_requests.p95:0.2" + tags,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("StatsD received %q, want %q", got, want)
+	}
+}
+
+func TestStatsDPacketSize(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client, err := net.Dial("udp", conn.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer := &statsDWriter{conn: client}
+	defer writer.close()
+
+	var points []*Point
+	for i := 0; i < 100; i++ {
+		points = append(points, &Point{Name: requestMeasurement, Tags: map[string]string{"command": "listVirtualMachines", "profile": "admin"},
+			Fields: map[string]float64{"duration": 0.1}, Time: pointTime})
+	}
+	if err := writer.write(points); err != nil {
+		t.Fatal(err)
+	}
+	lines := 0
+	packet := make([]byte, 65536)
+	for lines < len(points) {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := conn.ReadFrom(packet)
+		if err != nil {
+			t.Fatalf("received %d of %d lines: %s", lines, len(points), err)
+		}
+		if n > maxStatsDPacketSize {
+			t.Errorf("packet of %d bytes, larger than %d", n, maxStatsDPacketSize)
+		}
+		lines += len(strings.Split(string(packet[:n]), "\n"))
+	}
+}
@@ -0,0 +1,105 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package metrics
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Largest UDP packet sent to StatsD, below the usual MTU
+const maxStatsDPacketSize = 1432
+
+// Writes the points in the StatsD protocol, with the tags of the DogStatsD extension
+type statsDWriter struct {
+	conn net.Conn
+}
+
+/*
+Creates a sink sending the points to StatsD over UDP, like localhost:8125. The
+duration of every call is sent as a timing in milliseconds, and the fields of
+the interval points as gauges, like csbench_requests.p95:0.12|g. The tags are
+sent as |#name:value, which the Datadog agent and the StatsD input of Telegraf
+with datadog_extensions understand.
+*/
+func NewStatsDSink(address string, tags map[string]string, interval time.Duration) (*Sink, error) {
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	return newSink("StatsD "+address, &statsDWriter{conn: conn}, tags, interval), nil
+}
+
+func (w *statsDWriter) write(points []*Point) error {
+	var packet strings.Builder
+	for _, point := range points {
+		for _, line := range statsDLines(point) {
+			if packet.Len() > 0 && packet.Len()+len(line)+1 > maxStatsDPacketSize {
+				if _, err := w.conn.Write([]byte(packet.String())); err != nil {
+					return err
+				}
+				packet.Reset()
+			}
+			if packet.Len() > 0 {
+				packet.WriteByte('\n')
+			}
+			packet.WriteString(line)
+		}
+	}
+	if packet.Len() > 0 {
+		_, err := w.conn.Write([]byte(packet.String()))
+		return err
+	}
+	return nil
+}
+
+func (w *statsDWriter) close() error {
+	return w.conn.Close()
+}
+
+// Characters not allowed in the names and tags of the metrics
+var statsDEscaper = strings.NewReplacer(":", "_", "|", "_", "@", "_", "#", "_", ",", "_", " ", "_", "\n", "_")
+
+func statsDLines(point *Point) []string {
+	var tags []string
+	for _, name := range point.tagNames() {
+		if point.Tags[name] == "" {
+			continue
+		}
+		tags = append(tags, statsDEscaper.Replace(name)+":"+statsDEscaper.Replace(point.Tags[name]))
+	}
+	suffix := ""
+	if len(tags) > 0 {
+		suffix = "|#" + strings.Join(tags, ",")
+	}
+
+	var lines []string
+	for _, name := range point.fieldNames() {
+		metric := statsDEscaper.Replace(point.Name + "." + name)
+		value := point.Fields[name]
+		if point.Name == requestMeasurement && name == "duration" {
+			lines = append(lines, fmt.Sprintf("%s:%s|ms%s", metric, strconv.FormatFloat(value*1000, 'f', 3, 64), suffix))
+		} else {
+			lines = append(lines, fmt.Sprintf("%s:%s|g%s", metric, strconv.FormatFloat(value, 'f', -1, 64), suffix))
+		}
+	}
+	return lines
+}
@@ -0,0 +1,76 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package metrics
+
+import (
+	"bytes"
+	"csbench/failure"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// An http.RoundTripper counting the API calls going through it in the metrics.
+// Used for the calls made through the cloudstack-go client.
+type Transport struct {
+	Base    http.RoundTripper
+	Profile string
+}
+
+func NewTransport(base http.RoundTripper, profile string) *Transport {
+	return &Transport{Base: base, Profile: profile}
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !Enabled() {
+		return t.Base.RoundTrip(req)
+	}
+
+	command := req.URL.Query().Get("command")
+	if command == "" && req.Body != nil && req.Method == http.MethodPost {
+		body, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		if form, err := url.ParseQuery(string(body)); err == nil {
+			command = form.Get("command")
+		}
+	}
+
+	done := StartRequest(t.Profile)
+	defer done()
+	start := time.Now()
+	resp, err := t.Base.RoundTrip(req)
+	outcome := "success"
+	if err != nil {
+		outcome = string(failure.FromError(command, err).Category)
+	} else if resp.StatusCode >= 400 {
+		// CloudStack answers its errors with the error code as HTTP status and a JSON body
+		outcome = string(failure.HTTPStatus)
+		if strings.Contains(resp.Header.Get("Content-Type"), "json") {
+			outcome = string(failure.CloudStack)
+		}
+	}
+	// Time until the response headers, the body is read by the client
+	ObserveRequest(command, t.Profile, outcome, time.Since(start).Seconds())
+	return resp, err
+}
@@ -0,0 +1,182 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package replay
+
+import (
+	"bufio"
+	"csbench/samples"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// A call read from a recorded log, to send again
+type Request struct {
+	// When the call was made
+	Time    time.Time
+	Command string
+	// Profile that made the call, for csbench samples files
+	Profile string
+	// API key that signed the call, for the logs of the management server that have it
+	APIKey string
+	// Parameters of the call, without the command, the credentials and the signature
+	Params url.Values
+}
+
+// Parameters left out of the requests, set again when they are sent
+var authParams = map[string]bool{
+	"command": true, "apikey": true, "signature": true, "signatureversion": true, "expires": true,
+	"sessionkey": true, "response": true, "_": true,
+}
+
+/*
+Commands left out of the replay: the calls are authenticated with the profiles
+of the configuration rather than the sessions of the log, and the jobs of the
+log do not exist on the target
+*/
+var skippedCommands = map[string]bool{"login": true, "logout": true, "queryasyncjobresult": true}
+
+// Value of the secrets in csbench samples files
+const redacted = "********"
+
+var (
+	// A line of the access log of the management server, in the NCSA format, like
+	// 10.1.1.1 - - [10/Jan/2024:10:12:53 +0000] "GET /client/api?command=listZones&... HTTP/1.1" 200 1234
+	accessLogRegex = regexp.MustCompile(`\[([^\]]+)\] "(?:GET|POST) [^ "?]*\?([^ "]+)`)
+	// A line of the API log of the management server, apilog.log, like
+	// 2024-01-10 10:12:53,796 INFO  [a.c.c.a.ApiServer] (qtp-1:ctx-1) (logid:1a2b) 10.1.1.1 -- GET command=listZones&... 200 {...}
+	apiLogRegex = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}[,.]\d{3}).* -- (?:GET|POST) (\S+)`)
+)
+
+/*
+Reads the requests of a recorded log, oldest first. The format is guessed line
+by line, so that logs can be concatenated:
+ 1. csbench samples files, saved with -samples
+ 2. the API log of the management server, apilog.log
+ 3. access logs in the NCSA format, which only have the parameters of the GET calls
+
+Lines that are not requests, or whose command is skipped, are left out.
+*/
+func Load(path string) ([]*Request, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var requests []*Request
+	skipped := 0
+	scanner := bufio.NewScanner(file)
+	// The API log has the responses, which can be long
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		request := parseLine(line)
+		if request == nil || skippedCommands[strings.ToLower(request.Command)] {
+			skipped++
+			continue
+		}
+		requests = append(requests, request)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", path, err)
+	}
+	if len(requests) == 0 {
+		return nil, fmt.Errorf("no requests found in %s", path)
+	}
+	if skipped > 0 {
+		log.Infof("Skipped %d lines of %s that are not requests to replay", skipped, path)
+	}
+	sort.SliceStable(requests, func(i, j int) bool {
+		return requests[i].Time.Before(requests[j].Time)
+	})
+	return requests, nil
+}
+
+// Returns the request of a line of any of the formats, nil if the line is not a request
+func parseLine(line string) *Request {
+	if strings.HasPrefix(line, "{") {
+		sample := &samples.Sample{}
+		if err := json.Unmarshal([]byte(line), sample); err != nil {
+			return nil
+		}
+		params := url.Values{}
+		for key, value := range sample.Params {
+			params.Set(key, value)
+		}
+		request := newRequest(sample.Timestamp, params)
+		if request != nil {
+			request.Profile = sample.Profile
+		}
+		return request
+	}
+	if match := apiLogRegex.FindStringSubmatch(line); match != nil {
+		timestamp, err := time.ParseInLocation("2006-01-02 15:04:05.000", strings.Replace(match[1], ",", ".", 1), time.Local)
+		if err != nil {
+			return nil
+		}
+		return parseQuery(timestamp, match[2])
+	}
+	if match := accessLogRegex.FindStringSubmatch(line); match != nil {
+		timestamp, err := time.Parse("02/Jan/2006:15:04:05 -0700", match[1])
+		if err != nil {
+			return nil
+		}
+		return parseQuery(timestamp, match[2])
+	}
+	return nil
+}
+
+func parseQuery(timestamp time.Time, query string) *Request {
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		return nil
+	}
+	return newRequest(timestamp, params)
+}
+
+// Returns the request of the parameters of a call, nil if they have no command
+func newRequest(timestamp time.Time, params url.Values) *Request {
+	request := &Request{Time: timestamp, Params: url.Values{}}
+	for key, values := range params {
+		switch lower := strings.ToLower(key); {
+		case lower == "command":
+			request.Command = values[0]
+		case lower == "apikey":
+			if values[0] != redacted {
+				request.APIKey = values[0]
+			}
+		case !authParams[lower]:
+			request.Params[key] = values
+		}
+	}
+	if request.Command == "" {
+		return nil
+	}
+	return request
+}
@@ -0,0 +1,120 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package replay
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want *Request
+	}{
+		{"csbench sample",
+			`{"timestamp":"2024-01-10T10:12:53.796Z","command":"listVirtualMachines","profile":"user1","params":{"apiKey":"********","command":"listVirtualMachines","listall":"true","response":"json","signature":"********"},"status":200,"items":5,"bytes":2250,"duration":0.0149}`,
+			&Request{Time: time.Date(2024, 1, 10, 10, 12, 53, 796000000, time.UTC), Command: "listVirtualMachines", Profile: "user1",
+				Params: url.Values{"listall": {"true"}}}},
+		{"csbench sample with a redacted password",
+			`{"timestamp":"2024-01-10T10:12:53Z","command":"createUser","profile":"admin","params":{"command":"createUser","username":"u1","password":"********"}}`,
+			&Request{Time: time.Date(2024, 1, 10, 10, 12, 53, 0, time.UTC), Command: "createUser", Profile: "admin",
+				Params: url.Values{"username": {"u1"}, "password": {"********"}}}},
+		{"API log",
+			`2024-01-10 10:12:53,796 INFO  [a.c.c.a.ApiServer] (qtp-1:ctx-1) (logid:1a2b) 10.1.1.1 -- GET command=listZones&apiKey=key1&signature=abc%3D&response=json&available=true 200 {"listzonesresponse":{}}`,
+			&Request{Time: time.Date(2024, 1, 10, 10, 12, 53, 796000000, time.Local), Command: "listZones", APIKey: "key1",
+				Params: url.Values{"available": {"true"}}}},
+		{"API log of a POST with a session key",
+			`2024-01-10 10:12:54.001 INFO  [a.c.c.a.ApiServer] (qtp-1:ctx-2) (logid:1a2c) 10.1.1.1 -- POST command=stopVirtualMachine&id=vm-1&sessionkey=s1&_=1704881574001 200 {}`,
+			&Request{Time: time.Date(2024, 1, 10, 10, 12, 54, 1000000, time.Local), Command: "stopVirtualMachine",
+				Params: url.Values{"id": {"vm-1"}}}},
+		{"access log",
+			`10.1.1.1 - - [10/Jan/2024:10:12:53 +0100] "GET /client/api?command=listHosts&type=Routing&apikey=key2&expires=2024-01-10&signatureVersion=3 HTTP/1.1" 200 1234`,
+			&Request{Time: time.Date(2024, 1, 10, 9, 12, 53, 0, time.UTC), Command: "listHosts", APIKey: "key2",
+				Params: url.Values{"type": {"Routing"}}}},
+		{"access log without a query", `10.1.1.1 - - [10/Jan/2024:10:12:53 +0000] "POST /client/api HTTP/1.1" 200 1234`, nil},
+		{"query without a command", `10.1.1.1 - - [10/Jan/2024:10:12:53 +0000] "GET /client/api?id=1 HTTP/1.1" 200 1234`, nil},
+		{"invalid sample", `{"timestamp": 3}`, nil},
+		{"other log line", `2024-01-10 10:12:53,796 INFO  [c.c.a.ApiServer] (main) Started`, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := parseLine(test.line)
+			if test.want == nil || got == nil {
+				if got != test.want {
+					t.Errorf("parseLine() = %+v, want %+v", got, test.want)
+				}
+				return
+			}
+			if !got.Time.Equal(test.want.Time) {
+				t.Errorf("time %s, want %s", got.Time, test.want.Time)
+			}
+			got.Time = test.want.Time
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("parseLine() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	// Logs of several formats concatenated, out of order
+	lines := []string{
+		`10.1.1.1 - - [10/Jan/2024:10:12:55 +0000] "GET /client/api?command=listHosts HTTP/1.1" 200 1234`,
+		`{"timestamp":"2024-01-10T10:12:53Z","command":"listZones","profile":"admin","params":{"command":"listZones"}}`,
+		``,
+		`{"timestamp":"2024-01-10T10:12:54Z","command":"queryAsyncJobResult","profile":"admin","params":{"command":"queryAsyncJobResult","jobid":"j1"}}`,
+		`{"timestamp":"2024-01-10T10:12:54Z","command":"login","profile":"admin","params":{"command":"login"}}`,
+		`not a request`,
+		`{"timestamp":"2024-01-10T10:12:54Z","command":"listVolumes","profile":"admin","params":{"command":"listVolumes"}}`,
+	}
+	path := filepath.Join(t.TempDir(), "requests.log")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")), 0644); err != nil {
+		t.Fatal(err)
+	}
+	requests, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var commands []string
+	for _, request := range requests {
+		commands = append(commands, request.Command)
+	}
+	if want := []string{"listZones", "listVolumes", "listHosts"}; !reflect.DeepEqual(commands, want) {
+		t.Errorf("Load() = %v, want %v", commands, want)
+	}
+}
+
+func TestLoadWithoutRequests(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "requests.log")
+	if err := os.WriteFile(path, []byte("not a request\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil {
+		t.Error("Load() of a log without requests succeeded")
+	}
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.log")); err == nil {
+		t.Error("Load() of a missing file succeeded")
+	}
+}
@@ -0,0 +1,205 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package report
+
+import (
+	"csbench/apirunner"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type junitSuites struct {
+	XMLName  xml.Name      `xml:"testsuites"`
+	Name     string        `xml:"name,attr"`
+	Tests    int           `xml:"tests,attr"`
+	Failures int           `xml:"failures,attr"`
+	Suites   []*junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name       string           `xml:"name,attr"`
+	Tests      int              `xml:"tests,attr"`
+	Failures   int              `xml:"failures,attr"`
+	Timestamp  string           `xml:"timestamp,attr"`
+	Hostname   string           `xml:"hostname,attr"`
+	Properties []*junitProperty `xml:"properties>property,omitempty"`
+	Cases      []*junitCase     `xml:"testcase"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+/*
+Writes the report as JUnit XML. Every type of task, or every API of a profile,
+is a test case that fails when it did not meet its expectations, or had failed
+calls without expectations on how many may fail. The time of a test case is its
+average latency. Benchmarks have a test suite per profile.
+*/
+func (d *Document) WriteJUnit(w io.Writer) error {
+	suites := &junitSuites{Name: "csbench " + d.Mode}
+	suiteByName := make(map[string]*junitSuite)
+	addCase := func(suiteName string, testCase *junitCase) {
+		suite, ok := suiteByName[suiteName]
+		if !ok {
+			suite = &junitSuite{Name: suiteName, Timestamp: d.Generated.Format("2006-01-02T15:04:05"), Hostname: d.Host, Properties: d.properties()}
+			suiteByName[suiteName] = suite
+			suites.Suites = append(suites.Suites, suite)
+		}
+		suite.Cases = append(suite.Cases, testCase)
+		suite.Tests++
+		suites.Tests++
+		if testCase.Failure != nil {
+			suite.Failures++
+			suites.Failures++
+		}
+	}
+
+	for _, task := range d.Tasks {
+		addCase("csbench."+d.Mode, &junitCase{
+			Name:      task.Type,
+			ClassName: "csbench." + d.Mode,
+			Time:      fmt.Sprintf("%.3f", task.Avg),
+			Failure:   newJUnitFailure(task.Passed, task.Expectations, fmt.Sprintf("%d of %d tasks failed", task.Failed, task.Count), task.Errors),
+			SystemOut: fmt.Sprintf("count=%d failed=%d min=%.3f max=%.3f avg=%.3f median=%.3f p90=%.3f p95=%.3f p99=%.3f",
+				task.Count, task.Failed, task.Min, task.Max, task.Avg, task.Median, task.P90, task.P95, task.P99),
+		})
+	}
+	// Rows left with the same name, e.g. cases listed twice, are told apart by their index
+	names := make(map[string]int)
+	for _, api := range d.APIs {
+		suiteName := "csbench." + d.Mode + "." + api.Profile
+		name := api.name()
+		names[suiteName+"|"+name]++
+		if count := names[suiteName+"|"+name]; count > 1 {
+			name = fmt.Sprintf("%s #%d", name, count)
+		}
+		addCase(suiteName, &junitCase{
+			Name:      name,
+			ClassName: suiteName,
+			Time:      fmt.Sprintf("%.3f", api.Avg),
+			Failure:   newJUnitFailure(api.Passed, api.Expectations, fmt.Sprintf("%d of %d calls failed", api.Failed, api.Calls), api.Errors),
+			SystemOut: fmt.Sprintf("calls=%d failed=%d min=%.3f max=%.3f avg=%.3f median=%.3f p90=%.3f p95=%.3f p99=%.3f throughput=%.2f warmup=%d coldstart=%.3f",
+				api.Calls, api.Failed, api.Min, api.Max, api.Avg, api.Median, api.P90, api.P95, api.P99, api.Throughput, api.Warmup, api.ColdStart),
+		})
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(suites); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// Returns the metadata of the run as the properties of the test suites
+func (d *Document) properties() []*junitProperty {
+	m := d.Metadata
+	if m == nil {
+		return nil
+	}
+	properties := []*junitProperty{
+		{Name: "run", Value: m.Run},
+		{Name: "csbenchversion", Value: m.CsbenchVersion},
+		{Name: "commandline", Value: strings.Join(m.CommandLine, " ")},
+		{Name: "started", Value: m.Started.Format(time.RFC3339)},
+		{Name: "finished", Value: m.Finished.Format(time.RFC3339)},
+		{Name: "dbprofile", Value: strconv.Itoa(m.DBProfile)},
+		{Name: "confighash", Value: m.ConfigHash},
+		{Name: "url", Value: m.URL},
+		{Name: "cloudstackversion", Value: m.CloudStackVersion},
+	}
+	for _, server := range m.ManagementServers {
+		properties = append(properties, &junitProperty{Name: "managementserver." + server.Name, Value: fmt.Sprintf("%s %s %s", server.IPAddress, server.Version, server.State)})
+	}
+	resources := make([]string, 0, len(m.Inventory))
+	for resource := range m.Inventory {
+		resources = append(resources, resource)
+	}
+	sort.Strings(resources)
+	for _, resource := range resources {
+		properties = append(properties, &junitProperty{Name: "inventory." + resource, Value: strconv.Itoa(m.Inventory[resource])})
+	}
+	return properties
+}
+
+// Names the test case of an API after the command, and the case, parameters, page and stage telling it apart from the others
+func (api *API) name() string {
+	parts := []string{api.Command}
+	if api.Case != api.Command {
+		parts = append(parts, api.Case)
+	}
+	keys := make([]string, 0, len(api.Params))
+	for key := range api.Params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		parts = append(parts, key+"="+api.Params[key])
+	}
+	switch api.Page {
+	case 0:
+	case apirunner.AllPages:
+		parts = append(parts, fmt.Sprintf("page=all pagesize=%d", api.PageSize))
+	default:
+		parts = append(parts, fmt.Sprintf("page=%d pagesize=%d", api.Page, api.PageSize))
+	}
+	if api.Stage > 0 {
+		parts = append(parts, fmt.Sprintf("stage=%d", api.Stage))
+	}
+	return strings.Join(parts, " ")
+}
+
+// Returns the failure of a test case, nil if it passed. failed describes how many calls failed.
+func newJUnitFailure(passed bool, expectations []string, failed string, errors []*Error) *junitFailure {
+	if passed {
+		return nil
+	}
+	var text []string
+	for _, err := range errors {
+		text = append(text, fmt.Sprintf("%dx %s %s %d: %s", err.Count, err.Operation, err.Category, err.Code, err.Message))
+	}
+	if len(expectations) > 0 {
+		return &junitFailure{Message: "Did not meet the expectations: " + strings.Join(expectations, "; "), Type: "expectations", Text: strings.Join(text, "\n")}
+	}
+	return &junitFailure{Message: failed, Type: "errors", Text: strings.Join(text, "\n")}
+}
@@ -0,0 +1,311 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package report
+
+import (
+	"csbench/apirunner"
+	"csbench/failure"
+	"csbench/metadata"
+	"csbench/scenario"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/montanaflynn/stats"
+)
+
+// Version of the schema of the JSON report, increased when a field is renamed or removed
+const SchemaVersion = 1
+
+// The results of a run, written as JSON. The schema is documented in the README.
+type Document struct {
+	Schema int `json:"schema"`
+	// create, teardown, vmaction, benchmark or replay
+	Mode      string    `json:"mode"`
+	Host      string    `json:"host"`
+	Generated time.Time `json:"generated"`
+	// Settings of the run and environment it ran against
+	Metadata *metadata.Metadata `json:"metadata,omitempty"`
+	// Whether every task and API met its expectations
+	Passed bool `json:"passed"`
+	// Results by type of task, for create, teardown and vmaction
+	Tasks []*Task `json:"tasks,omitempty"`
+	// Results by API, profile, case and page, for benchmark and replay
+	APIs   []*API   `json:"apis,omitempty"`
+	Errors []*Error `json:"errors"`
+}
+
+// Latencies in seconds
+type Latency struct {
+	Min    float64 `json:"min"`
+	Max    float64 `json:"max"`
+	Avg    float64 `json:"avg"`
+	Median float64 `json:"median"`
+	P90    float64 `json:"p90"`
+	P95    float64 `json:"p95"`
+	P99    float64 `json:"p99"`
+}
+
+// The outcome of a create, teardown or VM action task
+type TaskResult struct {
+	Success  bool
+	Duration float64
+	// Stage the task was run in, 0 when not running stages
+	Stage int
+	// When the task finished
+	Time  time.Time
+	Error *failure.Error
+}
+
+// The results of a type of task, like domain or vm-destroy
+type Task struct {
+	Type      string  `json:"type"`
+	Count     int     `json:"count"`
+	Failed    int     `json:"failed"`
+	ErrorRate float64 `json:"errorrate"`
+	Latency
+	Stages []*Stage `json:"stages,omitempty"`
+	// Expectations that were not met
+	Expectations []string `json:"expectations,omitempty"`
+	Passed       bool     `json:"passed"`
+	Errors       []*Error `json:"errors"`
+}
+
+type Stage struct {
+	Stage  int `json:"stage"`
+	Count  int `json:"count"`
+	Failed int `json:"failed"`
+	Latency
+}
+
+// The results of an API called by a profile, with a page and page size
+type API struct {
+	Profile string `json:"profile"`
+	Case    string `json:"case"`
+	Command string `json:"command"`
+	// 0 if the calls were made without page parameters, -1 if they fetched every page
+	Page        int               `json:"page"`
+	PageSize    int               `json:"pagesize"`
+	Params      map[string]string `json:"params"`
+	Stage       int               `json:"stage,omitempty"`
+	Concurrency int               `json:"concurrency"`
+	Warmup      int               `json:"warmup,omitempty"`
+	Calls       int               `json:"calls"`
+	Failed      int               `json:"failed"`
+	// Number of items in the response
+	Items float64 `json:"items"`
+	Latency
+	// Latency of the first call, left out when not reported for the row
+	ColdStart     float64  `json:"coldstart,omitempty"`
+	P999          float64  `json:"p999"`
+	StdDev        float64  `json:"stddev"`
+	Throughput    float64  `json:"throughput"`
+	TargetRate    float64  `json:"targetrate,omitempty"`
+	ErrorRate     float64  `json:"errorrate"`
+	AsyncJobs     int      `json:"asyncjobs,omitempty"`
+	AvgSubmitTime float64  `json:"avgsubmittime,omitempty"`
+	AvgQueueTime  float64  `json:"avgqueuetime,omitempty"`
+	Expectations  []string `json:"expectations,omitempty"`
+	Passed        bool     `json:"passed"`
+	Errors        []*Error `json:"errors"`
+}
+
+// A group of similar errors
+type Error struct {
+	Operation string `json:"operation"`
+	Category  string `json:"category"`
+	Code      int    `json:"code"`
+	Message   string `json:"message"`
+	Count     int    `json:"count"`
+}
+
+/*
+Returns the report of the tasks of a create, teardown or VM action run. Every
+type of task is checked against expect, if set, and fails if any task failed
+unless expect sets how many may fail.
+*/
+func Tasks(mode string, host string, results map[string][]*TaskResult, expect *scenario.Expect) *Document {
+	document := newDocument(mode, host)
+	types := make([]string, 0, len(results))
+	for taskType := range results {
+		types = append(types, taskType)
+	}
+	sort.Strings(types)
+
+	errors := failure.NewCounter()
+	for _, taskType := range types {
+		taskErrors := failure.NewCounter()
+		task := &Task{Type: taskType}
+		var durations stats.Float64Data
+		stageDurations := make(map[int]stats.Float64Data)
+		stageFailed := make(map[int]int)
+		for _, result := range results[taskType] {
+			durations = append(durations, result.Duration)
+			if result.Stage > 0 {
+				stageDurations[result.Stage] = append(stageDurations[result.Stage], result.Duration)
+			}
+			if !result.Success {
+				task.Failed++
+				stageFailed[result.Stage]++
+				taskErrors.Add(result.Error)
+				errors.Add(result.Error)
+			}
+		}
+		task.Count = len(durations)
+		task.Latency = newLatency(durations)
+		if task.Count > 0 {
+			task.ErrorRate = round(float64(task.Failed) * 100 / float64(task.Count))
+		}
+		stages := make([]int, 0, len(stageDurations))
+		for stage := range stageDurations {
+			stages = append(stages, stage)
+		}
+		sort.Ints(stages)
+		for _, stage := range stages {
+			sample := stageDurations[stage]
+			task.Stages = append(task.Stages, &Stage{Stage: stage, Count: len(sample), Failed: stageFailed[stage], Latency: newLatency(sample)})
+		}
+		if expect != nil {
+			task.Expectations = expect.Check(task.ErrorRate, task.Avg, task.P95, task.P99)
+		}
+		task.Passed = len(task.Expectations) == 0 && (task.Failed == 0 || expect.ChecksErrors())
+		task.Errors = newErrors(taskErrors.Top(0))
+		document.Passed = document.Passed && task.Passed
+		document.Tasks = append(document.Tasks, task)
+	}
+	document.Errors = newErrors(errors.Top(0))
+	return document
+}
+
+// Returns the report of a benchmark or replay, from the summaries of the runner and its errors
+func Benchmark(mode string, host string, summaries []*apirunner.Summary, errors []*failure.Count) *Document {
+	document := newDocument(mode, host)
+	for _, s := range summaries {
+		api := &API{
+			Profile:     s.Profile,
+			Case:        s.Case,
+			Command:     s.Command,
+			Page:        s.Page,
+			PageSize:    s.PageSize,
+			Params:      make(map[string]string),
+			Concurrency: s.Concurrency,
+			Warmup:      s.Warmup,
+			Calls:       s.Calls,
+			Failed:      int(math.Round(s.ErrorRate * float64(s.Calls) / 100)),
+			Items:       s.Count,
+			Latency: Latency{
+				Min:    round(s.MinTime),
+				Max:    round(s.MaxTime),
+				Avg:    round(s.AvgTime),
+				Median: round(s.Median),
+				P90:    round(s.Percentile90),
+				P95:    round(s.Percentile95),
+				P99:    round(s.Percentile99),
+			},
+			ColdStart:     round(s.ColdStart),
+			P999:          round(s.Percentile999),
+			StdDev:        round(s.StdDev),
+			Throughput:    round(s.Throughput),
+			TargetRate:    s.TargetRate,
+			ErrorRate:     round(s.ErrorRate),
+			AsyncJobs:     s.AsyncJobs,
+			AvgSubmitTime: round(s.AvgSubmitTime),
+			AvgQueueTime:  round(s.AvgQueueTime),
+			Errors:        newErrors(s.Errors.Top(0)),
+		}
+		for name := range s.Params {
+			api.Params[name] = s.Params.Get(name)
+		}
+		if stage, err := strconv.Atoi(s.Stage); err == nil {
+			api.Stage = stage
+		}
+		if s.Expectations != "-" {
+			api.Expectations = strings.Split(s.Expectations, "; ")
+		}
+		api.Passed = len(api.Expectations) == 0 && (api.Failed == 0 || s.Expect.ChecksErrors())
+		document.Passed = document.Passed && api.Passed
+		document.APIs = append(document.APIs, api)
+	}
+	document.Errors = newErrors(errors)
+	return document
+}
+
+func (d *Document) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(d)
+}
+
+// Reads a report written by WriteJSON
+func Load(path string) (*Document, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	document := &Document{}
+	if err := json.Unmarshal(data, document); err != nil {
+		return nil, fmt.Errorf("invalid report %s: %w", path, err)
+	}
+	if document.Schema > SchemaVersion {
+		return nil, fmt.Errorf("the report %s has schema %d, this csbench reads up to %d", path, document.Schema, SchemaVersion)
+	}
+	return document, nil
+}
+
+func newDocument(mode string, host string) *Document {
+	return &Document{Schema: SchemaVersion, Mode: mode, Host: host, Generated: time.Now().UTC(), Passed: true}
+}
+
+func newLatency(sample stats.Float64Data) Latency {
+	min, _ := sample.Min()
+	max, _ := sample.Max()
+	mean, _ := sample.Mean()
+	median, _ := sample.Median()
+	percentile90, _ := sample.Percentile(90)
+	percentile95, _ := sample.Percentile(95)
+	percentile99, _ := sample.Percentile(99)
+	return Latency{
+		Min:    round(min),
+		Max:    round(max),
+		Avg:    round(mean),
+		Median: round(median),
+		P90:    round(percentile90),
+		P95:    round(percentile95),
+		P99:    round(percentile99),
+	}
+}
+
+func newErrors(counts []*failure.Count) []*Error {
+	errors := make([]*Error, 0, len(counts))
+	for _, count := range counts {
+		err := count.Error
+		errors = append(errors, &Error{Operation: err.Operation, Category: string(err.Category), Code: err.Code, Message: err.Message, Count: count.Count})
+	}
+	return errors
+}
+
+// Rounds latencies to the millisecond like the other reports, and rates to 3 decimals
+func round(value float64) float64 {
+	return math.Round(value*1000) / 1000
+}
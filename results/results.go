@@ -0,0 +1,273 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package results
+
+import (
+	"csbench/metadata"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+/*
+The results of every run are kept in a directory of their own,
+<resultsdir>/<host>/<run-id>, with a manifest describing the run and the files
+it saved. The index of all the runs, <resultsdir>/index.json, lists them without
+reading every manifest, and is rebuilt from the manifests if it is missing.
+*/
+const manifestFile = "manifest.json"
+const indexFile = "index.json"
+
+// Describes a run and the files saved in its directory
+type Manifest struct {
+	Host     string             `json:"host"`
+	Metadata *metadata.Metadata `json:"metadata"`
+	// Files of the run directory, relative to it
+	Files []string `json:"files"`
+}
+
+// A run of the index
+type Entry struct {
+	Run               string    `json:"run"`
+	Host              string    `json:"host"`
+	Modes             []string  `json:"modes"`
+	Started           time.Time `json:"started"`
+	Finished          time.Time `json:"finished"`
+	ConfigFile        string    `json:"configfile"`
+	ConfigHash        string    `json:"confighash"`
+	CloudStackVersion string    `json:"cloudstackversion,omitempty"`
+}
+
+// Returns whether the run ran the mode, like benchmark
+func (e *Entry) HasMode(mode string) bool {
+	for _, m := range e.Modes {
+		if m == mode {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the directory of the run
+func (e *Entry) Dir(resultsDir string) string {
+	return RunDir(resultsDir, e.Host, e.Run)
+}
+
+func newEntry(host string, m *metadata.Metadata) *Entry {
+	return &Entry{
+		Run:               m.Run,
+		Host:              host,
+		Modes:             m.Modes,
+		Started:           m.Started,
+		Finished:          m.Finished,
+		ConfigFile:        m.ConfigFile,
+		ConfigHash:        m.ConfigHash,
+		CloudStackVersion: m.CloudStackVersion,
+	}
+}
+
+// Returns the directory the results of the run against the host are saved to
+func RunDir(resultsDir string, host string, run string) string {
+	return filepath.Join(resultsDir, host, run)
+}
+
+/*
+Writes the manifest of the run, listing the files saved to its directory so far,
+and adds the run to the index. Returns the directory of the run.
+*/
+func Save(resultsDir string, host string, m *metadata.Metadata) (string, error) {
+	dir := RunDir(resultsDir, host, m.Run)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	manifest := &Manifest{Host: host, Metadata: m, Files: []string{}}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		file, err := filepath.Rel(dir, path)
+		if err == nil && file != manifestFile {
+			manifest.Files = append(manifest.Files, filepath.ToSlash(file))
+		}
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	if err := writeJSON(filepath.Join(dir, manifestFile), manifest); err != nil {
+		return "", err
+	}
+
+	entries, err := List(resultsDir)
+	if err != nil {
+		return "", err
+	}
+	entries = append(remove(entries, host, m.Run), newEntry(host, m))
+	return dir, writeIndex(resultsDir, entries)
+}
+
+// Returns the manifest of the run directory
+func LoadManifest(dir string) (*Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, manifestFile))
+	if err != nil {
+		return nil, err
+	}
+	manifest := &Manifest{}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest %s: %w", filepath.Join(dir, manifestFile), err)
+	}
+	return manifest, nil
+}
+
+// Returns the runs of the index, oldest first. The index is rebuilt from the
+// manifests of the run directories if it is missing.
+func List(resultsDir string) ([]*Entry, error) {
+	data, err := os.ReadFile(filepath.Join(resultsDir, indexFile))
+	if os.IsNotExist(err) {
+		return rebuild(resultsDir)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []*Entry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("invalid index %s, delete it to rebuild it: %w", filepath.Join(resultsDir, indexFile), err)
+	}
+	sortEntries(entries)
+	return entries, nil
+}
+
+// Returns the run with the id, or with an id starting with it if only one does
+func Find(resultsDir string, id string) (*Entry, error) {
+	entries, err := List(resultsDir)
+	if err != nil {
+		return nil, err
+	}
+	var matches []*Entry
+	for _, entry := range entries {
+		if entry.Run == id {
+			return entry, nil
+		}
+		if strings.HasPrefix(entry.Run, id) {
+			matches = append(matches, entry)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("no run %s in %s", id, resultsDir)
+	case 1:
+		return matches[0], nil
+	default:
+		return nil, fmt.Errorf("%d runs in %s start with %s", len(matches), resultsDir, id)
+	}
+}
+
+// Returns the last run against the host that ran the mode, nil if there is none
+func Latest(resultsDir string, host string, mode string) (*Entry, error) {
+	entries, err := List(resultsDir)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].Host == host && entries[i].HasMode(mode) {
+			return entries[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// Deletes the directory of the run with the id, or unique prefix of it, and removes it from the index
+func Delete(resultsDir string, id string) (*Entry, error) {
+	entry, err := Find(resultsDir, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.RemoveAll(entry.Dir(resultsDir)); err != nil {
+		return nil, err
+	}
+	os.Remove(filepath.Join(resultsDir, entry.Host))
+	entries, err := List(resultsDir)
+	if err != nil {
+		return nil, err
+	}
+	return entry, writeIndex(resultsDir, remove(entries, entry.Host, entry.Run))
+}
+
+// Returns the runs of the manifests of the run directories
+func rebuild(resultsDir string) ([]*Entry, error) {
+	manifests, err := filepath.Glob(filepath.Join(resultsDir, "*", "*", manifestFile))
+	if err != nil {
+		return nil, err
+	}
+	entries := []*Entry{}
+	for _, path := range manifests {
+		manifest, err := LoadManifest(filepath.Dir(path))
+		if err != nil {
+			return nil, err
+		}
+		if manifest.Metadata != nil {
+			entries = append(entries, newEntry(manifest.Host, manifest.Metadata))
+		}
+	}
+	sortEntries(entries)
+	return entries, nil
+}
+
+func remove(entries []*Entry, host string, run string) []*Entry {
+	kept := make([]*Entry, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Host != host || entry.Run != run {
+			kept = append(kept, entry)
+		}
+	}
+	return kept
+}
+
+func sortEntries(entries []*Entry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		if !entries[i].Started.Equal(entries[j].Started) {
+			return entries[i].Started.Before(entries[j].Started)
+		}
+		return entries[i].Run < entries[j].Run
+	})
+}
+
+// Replaces the index, through a temporary file so that it is never left half written
+func writeIndex(resultsDir string, entries []*Entry) error {
+	if err := os.MkdirAll(resultsDir, 0755); err != nil {
+		return err
+	}
+	sortEntries(entries)
+	temp := filepath.Join(resultsDir, indexFile+".tmp")
+	if err := writeJSON(temp, entries); err != nil {
+		return err
+	}
+	return os.Rename(temp, filepath.Join(resultsDir, indexFile))
+}
+
+func writeJSON(path string, value interface{}) error {
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
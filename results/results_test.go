@@ -0,0 +1,246 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package results
+
+import (
+	"csbench/metadata"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var started = time.Date(2024, 1, 15, 9, 30, 12, 0, time.UTC)
+
+func run(id string, minutes int, modes ...string) *metadata.Metadata {
+	return &metadata.Metadata{
+		Run:        id,
+		Modes:      modes,
+		Started:    started.Add(time.Duration(minutes) * time.Minute),
+		Finished:   started.Add(time.Duration(minutes+1) * time.Minute),
+		ConfigFile: "config/config",
+		ConfigHash: "abc",
+	}
+}
+
+// Saves the runs with a report in their directory, in the order given
+func saveRuns(t *testing.T, resultsDir string, host string, runs ...*metadata.Metadata) {
+	t.Helper()
+	for _, m := range runs {
+		dir := RunDir(resultsDir, host, m.Run)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "listZones.csv"), []byte("Count\n1\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Save(resultsDir, host, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func runIDs(entries []*Entry) []string {
+	var ids []string
+	for _, entry := range entries {
+		ids = append(ids, entry.Run)
+	}
+	return ids
+}
+
+func TestSave(t *testing.T) {
+	resultsDir := t.TempDir()
+	m := run("20240115-093012-7f3a", 0, "benchmark")
+	dir := RunDir(resultsDir, "10.0.3.5", m.Run)
+	if err := os.MkdirAll(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range []string{"benchmark.json", "listZones.csv", "sub/listHosts.csv"} {
+		if err := os.WriteFile(filepath.Join(dir, file), []byte("{}"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	saved, err := Save(resultsDir, "10.0.3.5", m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved != dir {
+		t.Errorf("Save() = %s, want %s", saved, dir)
+	}
+	manifest, err := LoadManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest.Host != "10.0.3.5" || manifest.Metadata.Run != m.Run {
+		t.Errorf("manifest of the run %s against %s", manifest.Metadata.Run, manifest.Host)
+	}
+	if want := []string{"benchmark.json", "listZones.csv", "sub/listHosts.csv"}; !reflect.DeepEqual(manifest.Files, want) {
+		t.Errorf("manifest files = %v, want %v", manifest.Files, want)
+	}
+
+	// Saving the run again, e.g. after another mode, replaces its entry
+	if _, err := Save(resultsDir, "10.0.3.5", m); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := List(resultsDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*Entry{{Run: m.Run, Host: "10.0.3.5", Modes: []string{"benchmark"}, Started: m.Started, Finished: m.Finished,
+		ConfigFile: "config/config", ConfigHash: "abc"}}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("List() = %+v, want %+v", entries, want)
+	}
+}
+
+func TestListRebuildsTheIndex(t *testing.T) {
+	resultsDir := t.TempDir()
+	saveRuns(t, resultsDir, "10.0.3.5", run("b", 10, "benchmark"), run("a", 0, "create"))
+	saveRuns(t, resultsDir, "10.0.3.6", run("c", 5, "benchmark"))
+	if err := os.Remove(filepath.Join(resultsDir, indexFile)); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := List(resultsDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids, want := runIDs(entries), []string{"a", "c", "b"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("List() = %v, want %v", ids, want)
+	}
+	if entries[1].Host != "10.0.3.6" {
+		t.Errorf("run c rebuilt with the host %s", entries[1].Host)
+	}
+}
+
+func TestListEmpty(t *testing.T) {
+	entries, err := List(filepath.Join(t.TempDir(), "results"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("List() of a missing directory = %v, want no runs", runIDs(entries))
+	}
+}
+
+func TestListInvalidIndex(t *testing.T) {
+	resultsDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(resultsDir, indexFile), []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := List(resultsDir); err == nil {
+		t.Error("List() with an invalid index succeeded")
+	}
+}
+
+func TestFind(t *testing.T) {
+	resultsDir := t.TempDir()
+	saveRuns(t, resultsDir, "10.0.3.5",
+		run("20240115-093012-7f3a", 0, "benchmark"),
+		run("20240115-093012-7f3a-2", 1, "benchmark"),
+		run("20240115-094500-11aa", 2, "create"),
+		run("20240116-080000-22bb", 3, "benchmark"))
+	tests := []struct {
+		id   string
+		want string
+	}{
+		// An exact id wins over the longer ids it is a prefix of
+		{"20240115-093012-7f3a", "20240115-093012-7f3a"},
+		{"20240115-0945", "20240115-094500-11aa"},
+		{"20240116", "20240116-080000-22bb"},
+		{"20240115", ""},
+		{"2023", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.id, func(t *testing.T) {
+			entry, err := Find(resultsDir, test.id)
+			if test.want == "" {
+				if err == nil {
+					t.Errorf("Find() = %s, want an error", entry.Run)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if entry.Run != test.want {
+				t.Errorf("Find() = %s, want %s", entry.Run, test.want)
+			}
+		})
+	}
+}
+
+func TestLatest(t *testing.T) {
+	resultsDir := t.TempDir()
+	saveRuns(t, resultsDir, "10.0.3.5", run("a", 0, "benchmark"), run("c", 20, "create", "benchmark"), run("d", 30, "teardown"))
+	saveRuns(t, resultsDir, "10.0.3.6", run("b", 10, "benchmark"))
+	tests := []struct {
+		host string
+		mode string
+		want string
+	}{
+		{"10.0.3.5", "benchmark", "c"},
+		{"10.0.3.5", "teardown", "d"},
+		{"10.0.3.6", "benchmark", "b"},
+		{"10.0.3.6", "create", ""},
+		{"10.0.3.7", "benchmark", ""},
+	}
+	for _, test := range tests {
+		entry, err := Latest(resultsDir, test.host, test.mode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := ""
+		if entry != nil {
+			got = entry.Run
+		}
+		if got != test.want {
+			t.Errorf("Latest(%s, %s) = %q, want %q", test.host, test.mode, got, test.want)
+		}
+	}
+}
+
+func TestDelete(t *testing.T) {
+	resultsDir := t.TempDir()
+	saveRuns(t, resultsDir, "10.0.3.5", run("20240115-093012-7f3a", 0, "benchmark"))
+	saveRuns(t, resultsDir, "10.0.3.6", run("20240116-080000-22bb", 1, "benchmark"))
+
+	entry, err := Delete(resultsDir, "20240115")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Run != "20240115-093012-7f3a" {
+		t.Errorf("Delete() = %s", entry.Run)
+	}
+	// The directory of the host is removed with its last run
+	if _, err := os.Stat(filepath.Join(resultsDir, "10.0.3.5")); !os.IsNotExist(err) {
+		t.Errorf("the directory of the host is left: %v", err)
+	}
+	entries, err := List(resultsDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids, want := runIDs(entries), []string{"20240116-080000-22bb"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("List() after Delete() = %v, want %v", ids, want)
+	}
+	if _, err := Delete(resultsDir, "20240115"); err == nil {
+		t.Error("Delete() of a deleted run succeeded")
+	}
+}
@@ -0,0 +1,141 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package samples
+
+import (
+	"encoding/json"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// A single API call, written as one line of the samples file
+type Sample struct {
+	Timestamp time.Time         `json:"timestamp"`
+	Command   string            `json:"command"`
+	Profile   string            `json:"profile"`
+	Params    map[string]string `json:"params"`
+	Status    int               `json:"status"`
+	ErrorCode int               `json:"errorcode,omitempty"`
+	ErrorText string            `json:"errortext,omitempty"`
+	Items     int               `json:"items"`
+	Bytes     int               `json:"bytes"`
+	Duration  float64           `json:"duration"`
+	// Whether the call was a warm-up call, left out of the statistics
+	Warmup bool `json:"warmup,omitempty"`
+}
+
+// Parameters whose values are never written to the samples file
+var secretParams = map[string]struct{}{
+	"apikey":     {},
+	"secretkey":  {},
+	"signature":  {},
+	"password":   {},
+	"sessionkey": {},
+}
+
+var (
+	lock    sync.Mutex
+	file    *os.File
+	encoder *json.Encoder
+)
+
+// Starts writing samples to the file, appending to it if it exists. Samples are
+// not buffered so that they are kept if the run is interrupted.
+func Open(path string) error {
+	lock.Lock()
+	defer lock.Unlock()
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	file = f
+	encoder = json.NewEncoder(file)
+	return nil
+}
+
+func Close() error {
+	lock.Lock()
+	defer lock.Unlock()
+	if file == nil {
+		return nil
+	}
+	err := file.Close()
+	file = nil
+	encoder = nil
+	return err
+}
+
+func Enabled() bool {
+	lock.Lock()
+	defer lock.Unlock()
+	return file != nil
+}
+
+// Writes the sample to the samples file, does nothing if samples are not enabled
+func Record(sample *Sample) {
+	lock.Lock()
+	defer lock.Unlock()
+	if encoder == nil {
+		return
+	}
+	if err := encoder.Encode(sample); err != nil {
+		log.Warnf("Failed to write sample for the API %s: %s", sample.Command, err)
+	}
+}
+
+// Returns the parameters of the call with the values of the secrets replaced
+func Redact(params url.Values) map[string]string {
+	redacted := make(map[string]string, len(params))
+	for key, values := range params {
+		if _, ok := secretParams[strings.ToLower(key)]; ok {
+			redacted[key] = "********"
+			continue
+		}
+		redacted[key] = strings.Join(values, ",")
+	}
+	return redacted
+}
+
+/*
+Returns the CloudStack error code and text of the response, and the number of
+items in it. Responses look like {"listvirtualmachinesresponse": {"count": 2,
+"virtualmachine": [...]}}, the items are the entries of the list.
+*/
+func ParseResponse(body []byte) (errorCode int, errorText string, items int) {
+	var data map[string]map[string]interface{}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return 0, "", 0
+	}
+	for _, response := range data {
+		if code, ok := response["errorcode"].(float64); ok {
+			errorCode = int(code)
+			errorText, _ = response["errortext"].(string)
+		}
+		for _, value := range response {
+			if list, ok := value.([]interface{}); ok {
+				items += len(list)
+			}
+		}
+	}
+	return errorCode, errorText, items
+}
@@ -0,0 +1,90 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package samples
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"csbench/failure"
+)
+
+// An http.RoundTripper recording a sample for every API call going through it.
+// Used for the calls made through the cloudstack-go client.
+type Transport struct {
+	Base    http.RoundTripper
+	Profile string
+}
+
+func NewTransport(base http.RoundTripper, profile string) *Transport {
+	return &Transport{Base: base, Profile: profile}
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !Enabled() {
+		return t.Base.RoundTrip(req)
+	}
+
+	params := req.URL.Query()
+	if req.Body != nil && req.Method == http.MethodPost {
+		body, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		if form, err := url.ParseQuery(string(body)); err == nil {
+			for key, values := range form {
+				params[key] = values
+			}
+		}
+	}
+
+	sample := &Sample{
+		Timestamp: time.Now(),
+		Command:   params.Get("command"),
+		Profile:   t.Profile,
+		Params:    Redact(params),
+	}
+	resp, err := t.Base.RoundTrip(req)
+	if err != nil {
+		sample.Duration = time.Since(sample.Timestamp).Seconds()
+		sample.ErrorText = failure.Message(err)
+		Record(sample)
+		return nil, err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	sample.Duration = time.Since(sample.Timestamp).Seconds()
+	sample.Status = resp.StatusCode
+	sample.Bytes = len(body)
+	if err != nil {
+		sample.ErrorText = failure.Message(err)
+		Record(sample)
+		return nil, err
+	}
+	sample.ErrorCode, sample.ErrorText, sample.Items = ParseResponse(body)
+	Record(sample)
+
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return resp, nil
+}
@@ -0,0 +1,184 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package scenario
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// A set of test cases to benchmark
+type Scenario struct {
+	Name  string  `yaml:"name"`
+	Cases []*Case `yaml:"cases"`
+}
+
+/*
+A named call to benchmark. Settings left empty fall back to the ones of the
+configuration file.
+
+When Pages or PageSizes are set, the case is run once for every combination of
+them, page 0 meaning without page parameters. Otherwise it is run with the page
+and pagesize of the configuration file, and without page parameters. Cases
+set to traverse walk all the pages of the collection with each of the PageSizes
+instead, ignoring Pages.
+*/
+type Case struct {
+	Name        string            `yaml:"name"`
+	Command     string            `yaml:"command"`
+	Params      map[string]string `yaml:"params"`
+	Iterations  int               `yaml:"iterations"`
+	Concurrency int               `yaml:"concurrency"`
+	Warmup      int               `yaml:"warmup"`
+	Pages       []int             `yaml:"pages"`
+	PageSizes   []int             `yaml:"pagesizes"`
+	// Fetch every page of the collection, with each of the PageSizes
+	Traverse bool `yaml:"traverse"`
+	// Profiles running the case, all of them if empty
+	Profiles []string `yaml:"profiles"`
+	Expect   *Expect  `yaml:"expect"`
+	// Rules the responses must follow, calls with an invalid response fail
+	Validate *Validate `yaml:"validate"`
+}
+
+// The expected outcome of a case. The limits left empty are not checked.
+type Expect struct {
+	// Whether all the calls should succeed, or all of them fail (e.g. a user
+	// calling an admin only API)
+	Success *bool `yaml:"success"`
+	// Highest percentage of failed calls
+	MaxErrorRate *float64 `yaml:"maxerrorrate"`
+	// Highest average, 95th and 99th percentile latencies in seconds
+	MaxAvgTime float64 `yaml:"maxavgtime"`
+	MaxP95Time float64 `yaml:"maxp95time"`
+	MaxP99Time float64 `yaml:"maxp99time"`
+}
+
+// Returns the expectations not met by results with the error rate in percent
+// and latencies in seconds, empty if all of them were met
+func (e *Expect) Check(errorRate float64, avgTime float64, p95Time float64, p99Time float64) []string {
+	var failures []string
+	if e.Success != nil {
+		if *e.Success && errorRate > 0 {
+			failures = append(failures, fmt.Sprintf("success (%.2f%% failed)", errorRate))
+		}
+		if !*e.Success && errorRate < 100 {
+			failures = append(failures, fmt.Sprintf("failure (%.2f%% succeeded)", 100-errorRate))
+		}
+	}
+	if e.MaxErrorRate != nil && errorRate > *e.MaxErrorRate {
+		failures = append(failures, fmt.Sprintf("maxerrorrate %.2f (%.2f)", *e.MaxErrorRate, errorRate))
+	}
+	if e.MaxAvgTime > 0 && avgTime > e.MaxAvgTime {
+		failures = append(failures, fmt.Sprintf("maxavgtime %.3f (%.3f)", e.MaxAvgTime, avgTime))
+	}
+	if e.MaxP95Time > 0 && p95Time > e.MaxP95Time {
+		failures = append(failures, fmt.Sprintf("maxp95time %.3f (%.3f)", e.MaxP95Time, p95Time))
+	}
+	if e.MaxP99Time > 0 && p99Time > e.MaxP99Time {
+		failures = append(failures, fmt.Sprintf("maxp99time %.3f (%.3f)", e.MaxP99Time, p99Time))
+	}
+	return failures
+}
+
+// Whether the expectation sets how many calls may fail. If it does not, any
+// failed call is a failure.
+func (e *Expect) ChecksErrors() bool {
+	return e != nil && (e.Success != nil || e.MaxErrorRate != nil)
+}
+
+/*
+Loads the scenario from the file. Files ending with .yaml, .yml or .json are read
+as structured scenarios, any other file in the text format of listCommands.txt.
+*/
+func Load(path string) (*Scenario, error) {
+	var scenario *Scenario
+	var err error
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml", ".json":
+		scenario, err = readStructured(path)
+	default:
+		scenario, err = readText(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(scenario.Cases) == 0 {
+		return nil, fmt.Errorf("no cases found in the scenario %s", path)
+	}
+	return scenario, nil
+}
+
+// Reads a YAML scenario. JSON is a subset of YAML, so JSON scenarios are read the same way.
+func readStructured(path string) (*Scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	scenario := &Scenario{}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(scenario); err != nil {
+		return nil, fmt.Errorf("error parsing the scenario %s: %w", path, err)
+	}
+	if scenario.Name == "" {
+		scenario.Name = filepath.Base(path)
+	}
+
+	for i, testCase := range scenario.Cases {
+		if testCase.Command == "" {
+			return nil, fmt.Errorf("case %d (%s) of the scenario %s has no command", i+1, testCase.Name, path)
+		}
+		if testCase.Name == "" {
+			testCase.Name = testCase.Command
+		}
+		if testCase.Params == nil {
+			testCase.Params = make(map[string]string)
+		}
+		if testCase.Validate != nil {
+			if err := testCase.Validate.load(filepath.Dir(path)); err != nil {
+				return nil, fmt.Errorf("case %d (%s) of the scenario %s: %w", i+1, testCase.Name, path, err)
+			}
+		}
+	}
+	return scenario, nil
+}
+
+// Returns the cases run by the profile
+func (s *Scenario) CasesFor(profile string) []*Case {
+	var cases []*Case
+	for _, testCase := range s.Cases {
+		if len(testCase.Profiles) == 0 {
+			cases = append(cases, testCase)
+			continue
+		}
+		for _, name := range testCase.Profiles {
+			if name == profile {
+				cases = append(cases, testCase)
+				break
+			}
+		}
+	}
+	return cases
+}
@@ -0,0 +1,208 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package scenario
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeScenario(t *testing.T, name string, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadText(t *testing.T) {
+	path := writeScenario(t, "listCommands.txt", `# Commands to benchmark
+listVirtualMachines state=Running
+
+listVirtualMachines state=Stopped
+listZones
+`)
+	s, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Scenario{Name: "listCommands.txt", Cases: []*Case{
+		{Name: "listVirtualMachines", Command: "listVirtualMachines", Params: map[string]string{"state": "Running"}},
+		{Name: "listVirtualMachines", Command: "listVirtualMachines", Params: map[string]string{"state": "Stopped"}},
+		{Name: "listZones", Command: "listZones", Params: map[string]string{}},
+	}}
+	if !reflect.DeepEqual(s, want) {
+		t.Errorf("Load() = %+v, want %+v", s, want)
+	}
+}
+
+func TestLoadStructured(t *testing.T) {
+	success := false
+	maxErrorRate := 5.0
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		want    *Scenario
+	}{
+		{"yaml", "nightly.yaml", `
+name: nightly
+cases:
+  - name: running vms
+    command: listVirtualMachines
+    params:
+      state: Running
+    iterations: 20
+    concurrency: 4
+    warmup: 2
+    pages: [0, 1]
+    pagesizes: [50, 500]
+    profiles: [admin]
+    expect:
+      maxerrorrate: 5
+      maxp95time: 0.5
+  - command: listZones
+    traverse: true
+    expect:
+      success: false
+`, &Scenario{Name: "nightly", Cases: []*Case{
+			{Name: "running vms", Command: "listVirtualMachines", Params: map[string]string{"state": "Running"}, Iterations: 20,
+				Concurrency: 4, Warmup: 2, Pages: []int{0, 1}, PageSizes: []int{50, 500}, Profiles: []string{"admin"},
+				Expect: &Expect{MaxErrorRate: &maxErrorRate, MaxP95Time: 0.5}},
+			{Name: "listZones", Command: "listZones", Params: map[string]string{}, Traverse: true, Expect: &Expect{Success: &success}},
+		}}},
+		{"json named after the file", "scenario.json", `{"cases": [{"command": "listHosts", "params": {"type": "Routing"}}]}`,
+			&Scenario{Name: "scenario.json", Cases: []*Case{
+				{Name: "listHosts", Command: "listHosts", Params: map[string]string{"type": "Routing"}},
+			}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s, err := Load(writeScenario(t, test.file, test.content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(s, test.want) {
+				t.Errorf("Load() = %+v, want %+v", s, test.want)
+			}
+		})
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+	}{
+		{"no cases", "empty.yaml", "name: empty\n"},
+		{"no cases in text", "empty.txt", "# nothing\n"},
+		{"case without command", "nocommand.yaml", "cases:\n  - name: vms\n"},
+		{"unknown field", "typo.yaml", "cases:\n  - command: listZones\n    iteration: 3\n"},
+		{"invalid yaml", "invalid.yaml", "cases: [\n"},
+		{"invalid text", "invalid.txt", "listZones name\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if s, err := Load(writeScenario(t, test.file, test.content)); err == nil {
+				t.Errorf("Load() = %+v, want an error", s)
+			}
+		})
+	}
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("Load() of a missing file succeeded")
+	}
+}
+
+func TestCasesFor(t *testing.T) {
+	s := &Scenario{Cases: []*Case{
+		{Name: "all"},
+		{Name: "admin", Profiles: []string{"admin"}},
+		{Name: "users", Profiles: []string{"user1", "user2"}},
+	}}
+	tests := []struct {
+		profile string
+		want    []string
+	}{
+		{"admin", []string{"all", "admin"}},
+		{"user2", []string{"all", "users"}},
+		{"other", []string{"all"}},
+	}
+	for _, test := range tests {
+		var names []string
+		for _, testCase := range s.CasesFor(test.profile) {
+			names = append(names, testCase.Name)
+		}
+		if !reflect.DeepEqual(names, test.want) {
+			t.Errorf("CasesFor(%s) = %v, want %v", test.profile, names, test.want)
+		}
+	}
+}
+
+func TestExpectCheck(t *testing.T) {
+	success, failure := true, false
+	zero, five := 0.0, 5.0
+	tests := []struct {
+		name      string
+		expect    *Expect
+		errorRate float64
+		avg       float64
+		p95       float64
+		p99       float64
+		want      []string
+	}{
+		{"all met", &Expect{Success: &success, MaxErrorRate: &zero, MaxAvgTime: 1, MaxP95Time: 1, MaxP99Time: 1}, 0, 0.5, 0.9, 1, nil},
+		{"no limits", &Expect{}, 50, 10, 10, 10, nil},
+		{"success with failures", &Expect{Success: &success}, 2.5, 0, 0, 0, []string{"success (2.50% failed)"}},
+		{"failure with successes", &Expect{Success: &failure}, 75, 0, 0, 0, []string{"failure (25.00% succeeded)"}},
+		{"failure met", &Expect{Success: &failure}, 100, 0, 0, 0, nil},
+		{"error rate", &Expect{MaxErrorRate: &five}, 6, 0, 0, 0, []string{"maxerrorrate 5.00 (6.00)"}},
+		{"latencies", &Expect{MaxAvgTime: 0.1, MaxP95Time: 0.2, MaxP99Time: 0.3}, 0, 0.15, 0.25, 0.35,
+			[]string{"maxavgtime 0.100 (0.150)", "maxp95time 0.200 (0.250)", "maxp99time 0.300 (0.350)"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := test.expect.Check(test.errorRate, test.avg, test.p95, test.p99)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Check() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestChecksErrors(t *testing.T) {
+	success := true
+	five := 5.0
+	tests := []struct {
+		expect *Expect
+		want   bool
+	}{
+		{nil, false},
+		{&Expect{MaxP95Time: 1}, false},
+		{&Expect{Success: &success}, true},
+		{&Expect{MaxErrorRate: &five}, true},
+	}
+	for _, test := range tests {
+		if got := test.expect.ChecksErrors(); got != test.want {
+			t.Errorf("ChecksErrors() of %+v = %t, want %t", test.expect, got, test.want)
+		}
+	}
+}
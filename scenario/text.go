@@ -0,0 +1,125 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package scenario
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+/*
+Reads a scenario in the text format of listCommands.txt, with one command per
+line followed by the parameters to send with it. For example:
+
+	listVirtualMachines state=Running details=min
+	listTemplates templatefilter=featured keyword="ubuntu 22.04"
+
+Values with spaces can be quoted. Words without an = are appended to the value
+of the previous parameter, so that lines like "listVolumes keyword=data disk"
+keep working. The same command can be listed several times with different
+parameters. Empty lines and lines starting with # are ignored.
+
+Every line becomes a case named after its command, run by all the profiles
+with the settings of the configuration file.
+*/
+func readText(filename string) (*Scenario, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scenario := &Scenario{Name: filepath.Base(filename)}
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		testCase, err := parseCommand(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", filename, lineNumber, err)
+		}
+		scenario.Cases = append(scenario.Cases, testCase)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return scenario, nil
+}
+
+func parseCommand(line string) (*Case, error) {
+	words, err := splitWords(line)
+	if err != nil {
+		return nil, err
+	}
+
+	testCase := &Case{Name: words[0], Command: words[0], Params: make(map[string]string)}
+	lastKey := ""
+	for _, word := range words[1:] {
+		key, value, found := strings.Cut(word, "=")
+		if !found || key == "" {
+			if lastKey == "" {
+				return nil, fmt.Errorf("invalid parameter %s for the command %s, expected key=value", word, testCase.Command)
+			}
+			testCase.Params[lastKey] += " " + word
+			continue
+		}
+		testCase.Params[key] = value
+		lastKey = key
+	}
+	return testCase, nil
+}
+
+// Splits the line on spaces, keeping the spaces inside double quotes
+func splitWords(line string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	quoted := false
+	for _, r := range line {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			inWord = true
+		case (r == ' ' || r == '\t') && !quoted:
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quoted {
+		return nil, fmt.Errorf("unterminated quote in %s", line)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
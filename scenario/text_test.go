@@ -0,0 +1,66 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package scenario
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCommand(t *testing.T) {
+	tests := []struct {
+		line   string
+		params map[string]string
+	}{
+		{"listVirtualMachines", map[string]string{}},
+		{"listVirtualMachines state=Running details=min", map[string]string{"state": "Running", "details": "min"}},
+		{`listTemplates templatefilter=featured keyword="ubuntu 22.04"`, map[string]string{"templatefilter": "featured", "keyword": "ubuntu 22.04"}},
+		{"listVolumes keyword=data disk", map[string]string{"keyword": "data disk"}},
+		{"listVolumes\tkeyword=data  disk  two", map[string]string{"keyword": "data disk two"}},
+		{"listHosts name=", map[string]string{"name": ""}},
+		{"listHosts tags=a=b", map[string]string{"tags": "a=b"}},
+		{`listNetworks keyword=""`, map[string]string{"keyword": ""}},
+	}
+	for _, test := range tests {
+		t.Run(test.line, func(t *testing.T) {
+			testCase, err := parseCommand(test.line)
+			if err != nil {
+				t.Fatal(err)
+			}
+			command, _ := splitWords(test.line)
+			if testCase.Command != command[0] || testCase.Name != command[0] {
+				t.Errorf("command %q and name %q, want %q", testCase.Command, testCase.Name, command[0])
+			}
+			if !reflect.DeepEqual(testCase.Params, test.params) {
+				t.Errorf("params %v, want %v", testCase.Params, test.params)
+			}
+		})
+	}
+}
+
+func TestParseCommandErrors(t *testing.T) {
+	for _, line := range []string{
+		"listVolumes data",
+		"listVolumes =data",
+		`listTemplates keyword="ubuntu`,
+	} {
+		if testCase, err := parseCommand(line); err == nil {
+			t.Errorf("parseCommand(%q) = %+v, want an error", line, testCase)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package scenario
+
+import (
+	"csbench/schema"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Number of items returned by the list APIs called without a page size, the
+// default.page.size of the management server
+const defaultPageSize = 500
+
+/*
+Rules the responses of a case are checked against, so that a list API silently
+returning less than it should is reported as failing rather than as faster. A
+call whose response breaks a rule is counted as failed.
+*/
+type Validate struct {
+	// The number of items of the response must match its count, or the page
+	// size for the pages before the last one
+	ItemCount bool `yaml:"itemcount"`
+	// Lowest and highest count of the response, not checked if 0
+	MinCount int `yaml:"mincount"`
+	MaxCount int `yaml:"maxcount"`
+	// Fields every item of the response must have, like nic or nic.ipaddress
+	Required []string `yaml:"required"`
+	// JSON schema file the response must match, relative to the scenario
+	Schema string `yaml:"schema"`
+
+	schema *schema.Schema
+}
+
+// Reads the JSON schema of the rules, dir being the directory of the scenario
+func (v *Validate) load(dir string) error {
+	if v.Schema == "" {
+		return nil
+	}
+	path := v.Schema
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	s, err := schema.Load(path)
+	if err != nil {
+		return err
+	}
+	v.schema = s
+	return nil
+}
+
+/*
+Returns the rules broken by the response of a call, the object of the
+<command>response key, made with the page and page size, 0 if the call was made
+without page parameters. Empty if the response is valid or there are no rules.
+*/
+func (v *Validate) Check(response map[string]interface{}, page int, pageSize int) []string {
+	if v == nil {
+		return nil
+	}
+	var failures []string
+	count, _ := response["count"].(float64)
+	items := responseItems(response)
+
+	if v.ItemCount {
+		expected := int(count)
+		if pageSize > 0 {
+			if page < 1 {
+				page = 1
+			}
+			expected -= (page - 1) * pageSize
+			if expected > pageSize {
+				expected = pageSize
+			}
+			if expected < 0 {
+				expected = 0
+			}
+		} else if expected > defaultPageSize {
+			expected = defaultPageSize
+		}
+		if len(items) != expected {
+			failures = append(failures, "the number of items does not match the count")
+		}
+	}
+	if v.MinCount > 0 && count < float64(v.MinCount) {
+		failures = append(failures, fmt.Sprintf("count below mincount %d", v.MinCount))
+	}
+	if v.MaxCount > 0 && count > float64(v.MaxCount) {
+		failures = append(failures, fmt.Sprintf("count above maxcount %d", v.MaxCount))
+	}
+	for _, field := range v.Required {
+		for _, item := range items {
+			if !hasField(item, field) {
+				failures = append(failures, fmt.Sprintf("item without the required field %s", field))
+				break
+			}
+		}
+	}
+	if v.schema != nil {
+		for _, problem := range v.schema.Validate(response) {
+			failures = append(failures, "schema "+problem)
+		}
+	}
+	return failures
+}
+
+// Returns the items of a list response, the array next to its count
+func responseItems(response map[string]interface{}) []interface{} {
+	for key, value := range response {
+		if items, ok := value.([]interface{}); ok && key != "count" {
+			return items
+		}
+	}
+	return nil
+}
+
+// Returns whether the item has the field, nested fields being separated by dots
+func hasField(item interface{}, field string) bool {
+	names := strings.Split(field, ".")
+	for i, name := range names {
+		// A field of a list of objects, like nic.ipaddress, must be in all of them
+		if list, ok := item.([]interface{}); ok {
+			rest := strings.Join(names[i:], ".")
+			for _, element := range list {
+				if !hasField(element, rest) {
+					return false
+				}
+			}
+			return true
+		}
+		object, ok := item.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		if item, ok = object[name]; !ok {
+			return false
+		}
+	}
+	return true
+}
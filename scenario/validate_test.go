@@ -0,0 +1,116 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package scenario
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// Returns a list response with the count and the items, given as JSON
+func listResponse(count int, items ...string) map[string]interface{} {
+	list := []interface{}{}
+	for _, item := range items {
+		var value interface{}
+		if err := json.Unmarshal([]byte(item), &value); err != nil {
+			panic(err)
+		}
+		list = append(list, value)
+	}
+	return map[string]interface{}{"count": float64(count), "virtualmachine": list}
+}
+
+func TestValidateCheck(t *testing.T) {
+	vm := `{"id": "1", "nic": [{"ipaddress": "10.0.0.1"}, {"ipaddress": "10.0.0.2"}]}`
+	vmWithoutIP := `{"id": "2", "nic": [{"ipaddress": "10.0.0.3"}, {"macaddress": "02:00"}]}`
+	tests := []struct {
+		name     string
+		rules    *Validate
+		response map[string]interface{}
+		page     int
+		pageSize int
+		want     []string
+	}{
+		{"no rules", nil, listResponse(3), 0, 0, nil},
+		{"item count matches", &Validate{ItemCount: true}, listResponse(2, vm, vm), 0, 0, nil},
+		{"item count below the count", &Validate{ItemCount: true}, listResponse(3, vm, vm), 0, 0,
+			[]string{"the number of items does not match the count"}},
+		{"full page", &Validate{ItemCount: true}, listResponse(5, vm, vm), 1, 2, nil},
+		{"last page", &Validate{ItemCount: true}, listResponse(5, vm), 3, 2, nil},
+		{"short page", &Validate{ItemCount: true}, listResponse(5, vm), 2, 2,
+			[]string{"the number of items does not match the count"}},
+		{"page after the last one", &Validate{ItemCount: true}, listResponse(5), 4, 2, nil},
+		{"count within the limits", &Validate{MinCount: 1, MaxCount: 2}, listResponse(2, vm, vm), 0, 0, nil},
+		{"count below mincount", &Validate{MinCount: 3}, listResponse(2, vm, vm), 0, 0, []string{"count below mincount 3"}},
+		{"count above maxcount", &Validate{MaxCount: 1}, listResponse(2, vm, vm), 0, 0, []string{"count above maxcount 1"}},
+		{"required fields", &Validate{Required: []string{"id", "nic.ipaddress"}}, listResponse(1, vm), 0, 0, nil},
+		{"required field missing", &Validate{Required: []string{"id", "name", "nic.ipaddress"}}, listResponse(2, vm, vmWithoutIP), 0, 0,
+			[]string{"item without the required field name", "item without the required field nic.ipaddress"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := test.rules.Check(test.response, test.page, test.pageSize)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Check() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestValidateWithoutPageSize(t *testing.T) {
+	// Without a page size the management server returns at most its default page size
+	items := make([]interface{}, defaultPageSize)
+	response := map[string]interface{}{"count": float64(defaultPageSize + 20), "virtualmachine": items}
+	rules := &Validate{ItemCount: true}
+	if got := rules.Check(response, 0, 0); got != nil {
+		t.Errorf("Check() = %q, want no failures", got)
+	}
+}
+
+func TestValidateSchema(t *testing.T) {
+	dir := t.TempDir()
+	schema := `{"type": "object", "required": ["count"], "properties": {"virtualmachine": {"items": {"required": ["state"]}}}}`
+	if err := os.WriteFile(filepath.Join(dir, "vm.json"), []byte(schema), 0644); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "scenario.yaml")
+	scenario := "cases:\n  - command: listVirtualMachines\n    validate:\n      itemcount: true\n      schema: vm.json\n"
+	if err := os.WriteFile(path, []byte(scenario), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules := s.Cases[0].Validate
+	got := rules.Check(listResponse(2, `{"id": "1"}`), 0, 0)
+	want := []string{"the number of items does not match the count", "schema $.virtualmachine[]: missing required property state"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Check() = %q, want %q", got, want)
+	}
+}
+
+func TestValidateMissingSchema(t *testing.T) {
+	path := writeScenario(t, "scenario.yaml", "cases:\n  - command: listZones\n    validate:\n      schema: missing.json\n")
+	if s, err := Load(path); err == nil {
+		t.Errorf("Load() = %+v, want an error", s)
+	}
+}
@@ -0,0 +1,292 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+/*
+A JSON schema, with the subset of the keywords needed to check the responses of
+the APIs: type, enum, properties, required, additionalProperties (true or
+false), items, minItems, maxItems, minimum, maximum, minLength, maxLength and
+pattern. Schemas using other keywords, like $ref or oneOf, are rejected rather
+than partially checked.
+*/
+type Schema struct {
+	// A type, or a list of types
+	Type                 interface{}        `json:"type"`
+	Enum                 []interface{}      `json:"enum"`
+	Properties           map[string]*Schema `json:"properties"`
+	Required             []string           `json:"required"`
+	AdditionalProperties *bool              `json:"additionalProperties"`
+	Items                *Schema            `json:"items"`
+	MinItems             *int               `json:"minItems"`
+	MaxItems             *int               `json:"maxItems"`
+	Minimum              *float64           `json:"minimum"`
+	Maximum              *float64           `json:"maximum"`
+	MinLength            *int               `json:"minLength"`
+	MaxLength            *int               `json:"maxLength"`
+	Pattern              string             `json:"pattern"`
+
+	types   []string
+	pattern *regexp.Regexp
+}
+
+// Keywords that are read, or that do not change the outcome of the validation
+var knownKeywords = map[string]bool{
+	"type": true, "enum": true, "properties": true, "required": true, "additionalProperties": true, "items": true,
+	"minItems": true, "maxItems": true, "minimum": true, "maximum": true, "minLength": true, "maxLength": true, "pattern": true,
+	"$schema": true, "$id": true, "title": true, "description": true, "examples": true, "default": true, "$comment": true,
+}
+
+var knownTypes = map[string]bool{"object": true, "array": true, "string": true, "number": true, "integer": true, "boolean": true, "null": true}
+
+// Reads the schema from the JSON file
+func Load(path string) (*Schema, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schema %s: %w", path, err)
+	}
+	return s, nil
+}
+
+func Parse(data []byte) (*Schema, error) {
+	var raw interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	if err := checkKeywords(raw, "$"); err != nil {
+		return nil, err
+	}
+	s := &Schema{}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, err
+	}
+	return s, s.compile("$")
+}
+
+// Returns an error for the first keyword of the schema, or of its subschemas, that is not supported
+func checkKeywords(raw interface{}, path string) error {
+	object, ok := raw.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("%s: a schema must be an object", path)
+	}
+	for keyword, value := range object {
+		if !knownKeywords[keyword] {
+			return fmt.Errorf("%s: unsupported keyword %s", path, keyword)
+		}
+		switch keyword {
+		case "properties":
+			properties, ok := value.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("%s: properties must be an object", path)
+			}
+			for name, property := range properties {
+				if err := checkKeywords(property, path+"."+name); err != nil {
+					return err
+				}
+			}
+		case "items":
+			if err := checkKeywords(value, path+"[]"); err != nil {
+				return err
+			}
+		case "additionalProperties":
+			if _, ok := value.(bool); !ok {
+				return fmt.Errorf("%s: only true or false are supported for additionalProperties", path)
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Schema) compile(path string) error {
+	switch t := s.Type.(type) {
+	case nil:
+	case string:
+		s.types = []string{t}
+	case []interface{}:
+		for _, value := range t {
+			name, ok := value.(string)
+			if !ok {
+				return fmt.Errorf("%s: invalid type %v", path, value)
+			}
+			s.types = append(s.types, name)
+		}
+	default:
+		return fmt.Errorf("%s: invalid type %v", path, t)
+	}
+	for _, name := range s.types {
+		if !knownTypes[name] {
+			return fmt.Errorf("%s: unknown type %s", path, name)
+		}
+	}
+	if s.Pattern != "" {
+		pattern, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return fmt.Errorf("%s: invalid pattern: %w", path, err)
+		}
+		s.pattern = pattern
+	}
+	for name, property := range s.Properties {
+		if err := property.compile(path + "." + name); err != nil {
+			return err
+		}
+	}
+	if s.Items != nil {
+		return s.Items.compile(path + "[]")
+	}
+	return nil
+}
+
+/*
+Returns the reasons the decoded JSON value does not match the schema, empty if
+it does. Each reason starts with the path of the value, with the indexes of the
+arrays left out, like $.virtualmachine[].state, so that the same problem in
+several items is reported once.
+*/
+func (s *Schema) Validate(value interface{}) []string {
+	seen := make(map[string]bool)
+	var problems []string
+	s.validate(value, "$", func(path string, format string, args ...interface{}) {
+		problem := path + ": " + fmt.Sprintf(format, args...)
+		if !seen[problem] {
+			seen[problem] = true
+			problems = append(problems, problem)
+		}
+	})
+	return problems
+}
+
+func (s *Schema) validate(value interface{}, path string, fail func(path string, format string, args ...interface{})) {
+	if len(s.types) > 0 && !s.hasType(value) {
+		fail(path, "expected %s, got %s", strings.Join(s.types, " or "), typeOf(value))
+		return
+	}
+	if len(s.Enum) > 0 {
+		allowed := false
+		for _, option := range s.Enum {
+			allowed = allowed || equal(option, value)
+		}
+		if !allowed {
+			fail(path, "not one of the allowed values")
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				fail(path, "missing required property %s", name)
+			}
+		}
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if property, ok := s.Properties[name]; ok {
+				property.validate(v[name], path+"."+name, fail)
+			} else if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+				fail(path, "unexpected property %s", name)
+			}
+		}
+	case []interface{}:
+		if s.MinItems != nil && len(v) < *s.MinItems {
+			fail(path, "fewer than %d items", *s.MinItems)
+		}
+		if s.MaxItems != nil && len(v) > *s.MaxItems {
+			fail(path, "more than %d items", *s.MaxItems)
+		}
+		if s.Items != nil {
+			for _, item := range v {
+				s.Items.validate(item, path+"[]", fail)
+			}
+		}
+	case float64:
+		if s.Minimum != nil && v < *s.Minimum {
+			fail(path, "below the minimum %g", *s.Minimum)
+		}
+		if s.Maximum != nil && v > *s.Maximum {
+			fail(path, "above the maximum %g", *s.Maximum)
+		}
+	case string:
+		length := len([]rune(v))
+		if s.MinLength != nil && length < *s.MinLength {
+			fail(path, "shorter than %d characters", *s.MinLength)
+		}
+		if s.MaxLength != nil && length > *s.MaxLength {
+			fail(path, "longer than %d characters", *s.MaxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			fail(path, "does not match the pattern %s", s.Pattern)
+		}
+	}
+}
+
+func (s *Schema) hasType(value interface{}) bool {
+	actual := typeOf(value)
+	for _, name := range s.types {
+		if name == actual || (name == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the JSON schema type of a value decoded by encoding/json
+func typeOf(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func equal(a interface{}, b interface{}) bool {
+	left, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	right, err := json.Marshal(b)
+	return err == nil && string(left) == string(right)
+}
@@ -0,0 +1,133 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package schema
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const vmSchema = `{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "title": "listVirtualMachines",
+  "type": "object",
+  "required": ["count", "virtualmachine"],
+  "properties": {
+    "count": {"type": "integer", "minimum": 1},
+    "virtualmachine": {
+      "type": "array",
+      "minItems": 1,
+      "maxItems": 3,
+      "items": {
+        "type": "object",
+        "required": ["id", "state"],
+        "additionalProperties": false,
+        "properties": {
+          "id": {"type": "string", "pattern": "^[0-9a-f-]{36}$"},
+          "name": {"type": "string", "minLength": 1, "maxLength": 8},
+          "state": {"enum": ["Running", "Stopped"]},
+          "cpunumber": {"type": "number", "maximum": 64},
+          "haenable": {"type": ["boolean", "null"]}
+        }
+      }
+    }
+  }
+}`
+
+func TestValidate(t *testing.T) {
+	s, err := Parse([]byte(vmSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+	vm := `{"id": "0b1f2c3d-4e5f-6071-8293-a4b5c6d7e8f9", "name": "web", "state": "Running", "cpunumber": 2, "haenable": null}`
+	tests := []struct {
+		name     string
+		response string
+		want     []string
+	}{
+		{"valid", `{"count": 1, "virtualmachine": [` + vm + `]}`, nil},
+		{"not an object", `[]`, []string{"$: expected object, got array"}},
+		{"missing properties", `{}`, []string{"$: missing required property count", "$: missing required property virtualmachine"}},
+		{"number instead of integer", `{"count": 1.5, "virtualmachine": [` + vm + `]}`, []string{"$.count: expected integer, got number"}},
+		{"below the minimum", `{"count": 0, "virtualmachine": [` + vm + `]}`, []string{"$.count: below the minimum 1"}},
+		{"too few items", `{"count": 1, "virtualmachine": []}`, []string{"$.virtualmachine: fewer than 1 items"}},
+		{"too many items", `{"count": 4, "virtualmachine": [` + vm + `,` + vm + `,` + vm + `,` + vm + `]}`, []string{"$.virtualmachine: more than 3 items"}},
+		{"invalid items reported once", `{"count": 2, "virtualmachine": [{"id": "1", "state": "Starting"}, {"id": "2", "state": "Error"}]}`,
+			[]string{"$.virtualmachine[].id: does not match the pattern ^[0-9a-f-]{36}$", "$.virtualmachine[].state: not one of the allowed values"}},
+		{"item without a required property", `{"count": 1, "virtualmachine": [{"id": "0b1f2c3d-4e5f-6071-8293-a4b5c6d7e8f9"}]}`,
+			[]string{"$.virtualmachine[]: missing required property state"}},
+		{"unexpected property", `{"count": 1, "virtualmachine": [{"id": "0b1f2c3d-4e5f-6071-8293-a4b5c6d7e8f9", "state": "Running", "nic": []}]}`,
+			[]string{"$.virtualmachine[]: unexpected property nic"}},
+		{"string lengths", `{"count": 2, "virtualmachine": [{"id": "0b1f2c3d-4e5f-6071-8293-a4b5c6d7e8f9", "state": "Running", "name": ""}, {"id": "0b1f2c3d-4e5f-6071-8293-a4b5c6d7e8f9", "state": "Running", "name": "webserver"}]}`,
+			[]string{"$.virtualmachine[].name: shorter than 1 characters", "$.virtualmachine[].name: longer than 8 characters"}},
+		{"above the maximum and wrong type", `{"count": 1, "virtualmachine": [{"id": "0b1f2c3d-4e5f-6071-8293-a4b5c6d7e8f9", "state": "Running", "cpunumber": 128, "haenable": "yes"}]}`,
+			[]string{"$.virtualmachine[].cpunumber: above the maximum 64", "$.virtualmachine[].haenable: expected boolean or null, got string"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var response interface{}
+			if err := json.Unmarshal([]byte(test.response), &response); err != nil {
+				t.Fatal(err)
+			}
+			if got := s.Validate(response); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Validate() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+	}{
+		{"invalid JSON", `{"type": `},
+		{"not an object", `["object"]`},
+		{"unsupported keyword", `{"type": "object", "oneOf": []}`},
+		{"unsupported nested keyword", `{"properties": {"nic": {"items": {"$ref": "#/nic"}}}}`},
+		{"schema of additionalProperties", `{"additionalProperties": {"type": "string"}}`},
+		{"properties not an object", `{"properties": []}`},
+		{"unknown type", `{"type": "float"}`},
+		{"invalid type", `{"type": 3}`},
+		{"invalid type in a list", `{"type": ["string", 3]}`},
+		{"invalid pattern", `{"properties": {"id": {"pattern": "("}}}`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := Parse([]byte(test.schema)); err == nil {
+				t.Errorf("Parse(%s) succeeded", test.schema)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vm.json")
+	if err := os.WriteFile(path, []byte(vmSchema), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("Load() of a missing file succeeded")
+	}
+}